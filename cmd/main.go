@@ -1,20 +1,131 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/tyxben/goloadtest/internal/datasource"
+	"github.com/tyxben/goloadtest/internal/report"
 	"github.com/tyxben/goloadtest/internal/runner"
+	"github.com/tyxben/goloadtest/internal/threshold"
+	"github.com/tyxben/goloadtest/internal/worker"
 	"github.com/tyxben/goloadtest/pkg/config"
 )
 
+// exitThresholdsFailed 是阈值未满足时的进程退出码，便于 CI 区分配置错误和性能不达标
+const exitThresholdsFailed = 99
+
+// exitInterrupted 是测试被信号中断时的进程退出码
+const exitInterrupted = 130
+
 func main() {
 	cfg, err := config.Parse()
 	if err != nil {
 		log.Fatalf("解析配置失败: %v", err)
 	}
+	if err := report.Validate(cfg.Outputs); err != nil {
+		log.Fatalf("解析配置失败: %v", err)
+	}
+	if err := threshold.Validate(cfg.Thresholds); err != nil {
+		log.Fatalf("解析配置失败: %v", err)
+	}
+	if err := worker.CompileTemplates(cfg.BaseURL, cfg.APIs); err != nil {
+		log.Fatalf("解析配置失败: %v", err)
+	}
+	if err := worker.ValidateExtractors(cfg.APIs); err != nil {
+		log.Fatalf("解析配置失败: %v", err)
+	}
+	if err := worker.ValidateChecks(cfg.APIs); err != nil {
+		log.Fatalf("解析配置失败: %v", err)
+	}
+	if err := worker.CompileAuth(cfg); err != nil {
+		log.Fatalf("解析配置失败: %v", err)
+	}
+	if err := worker.ConfigureTransport(cfg.Transport); err != nil {
+		log.Fatalf("解析配置失败: %v", err)
+	}
+	for _, scenario := range cfg.ScenarioConfigs() {
+		err := worker.ValidateWorkflow(scenario.Workflow, cfg.APIs)
+		if err == nil {
+			if err = worker.ValidateWorkflow(scenario.VUSetup, cfg.APIs); err != nil {
+				err = fmt.Errorf("vuSetup: %w", err)
+			}
+		}
+		if err == nil && scenario.TestData.Path != "" {
+			if err = datasource.Validate(scenario.TestData); err != nil {
+				err = fmt.Errorf("测试数据 %s: %w", scenario.TestData.Path, err)
+			}
+		}
+		if err != nil {
+			if scenario.Scenario != "" {
+				err = fmt.Errorf("场景 %s: %w", scenario.Scenario, err)
+			}
+			log.Fatalf("解析配置失败: %v", err)
+		}
+	}
+
+	if err := worker.ValidateWorkflow(cfg.Setup, cfg.APIs); err != nil {
+		log.Fatalf("解析配置失败: setup: %v", err)
+	}
+	if err := worker.ValidateWorkflow(cfg.Teardown, cfg.APIs); err != nil {
+		log.Fatalf("解析配置失败: teardown: %v", err)
+	}
+
+	for name, ds := range cfg.Datasets {
+		if err := datasource.Validate(ds.Source); err != nil {
+			log.Fatalf("解析配置失败: 数据集 %s: %v", name, err)
+		}
+	}
 
 	r := runner.NewRunner(cfg)
-	r.Run()
+	if err := r.Run(handleSignals()); err != nil {
+		worker.FlushLogs()
+		if r.Interrupted {
+			log.Printf("%v", err)
+			os.Exit(exitInterrupted)
+		}
+		log.Fatalf("%v", err)
+	}
+	worker.FlushLogs()
+	if r.Interrupted {
+		log.Println("测试被中断，以下为中断前的部分结果")
+	}
 
 	r.Stats.Print()
+
+	results := threshold.Evaluate(cfg.Thresholds, r.Stats, r.Stats.Elapsed)
+	threshold.Print(os.Stdout, results)
+
+	if err := report.Write(cfg.Outputs, report.Build(r.Stats, cfg, results)); err != nil {
+		log.Fatalf("输出报告失败: %v", err)
+	}
+
+	if r.Aborted || threshold.Failed(results) {
+		os.Exit(exitThresholdsFailed)
+	}
+	if r.Interrupted {
+		os.Exit(exitInterrupted)
+	}
+}
+
+// handleSignals 返回收到 SIGINT 或 SIGTERM 时被取消的 context。
+// 第一次收到信号时优雅停止，再次收到信号时立即退出
+func handleSignals() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Printf("收到信号 %v，正在停止测试，再次发送信号立即退出", sig)
+		cancel()
+		<-signals
+		log.Println("再次收到信号，立即退出")
+		worker.FlushLogs()
+		os.Exit(exitInterrupted)
+	}()
+	return ctx
 }
@@ -2,24 +2,30 @@ package auth
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/tidwall/gjson"
 )
 
-// LoginResponse 定义登录响应的结构
-type LoginResponse struct {
-	Token string `json:"token"`
-	// 可以根据实际登录响应添加其他字段
-}
-
-// Login 处理登录并获取token
-func Login(loginURL string, loginBody []byte) (string, error) {
-	resp, err := http.Post(loginURL, "application/json", bytes.NewBuffer(loginBody))
+// Login 发送登录请求，从 JSON 响应中按 gjson 路径 tokenPath 读取令牌，tokenPath 为空时读取 token 字段。
+// ctx 被取消时中止登录请求。
+//
+// 注意：ctx 是新增的第一个参数，原来的调用 Login(client, ...) 需要改为 Login(ctx, client, ...)
+func Login(ctx context.Context, client *http.Client, loginURL string, loginBody []byte, tokenPath string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, loginURL, bytes.NewReader(loginBody))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("登录请求失败: %w", err)
 	}
@@ -29,23 +35,30 @@ func Login(loginURL string, loginBody []byte) (string, error) {
 		return "", fmt.Errorf("登录失败，状态码: %d", resp.StatusCode)
 	}
 
-	var loginResp LoginResponse
-	if err := json.NewDecoder(resp.Body).Decode(&loginResp); err != nil {
-		return "", fmt.Errorf("解析登录响应失败: %w", err)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("读取登录响应失败: %w", err)
+	}
+	if !gjson.ValidBytes(body) {
+		return "", fmt.Errorf("解析登录响应失败: 不是合法的 JSON")
 	}
 
-	if loginResp.Token == "" {
+	if tokenPath == "" {
+		tokenPath = "token"
+	}
+	token := gjson.GetBytes(body, tokenPath).String()
+	if token == "" {
 		return "", fmt.Errorf("登录响应中未找到token")
 	}
 
-	return loginResp.Token, nil
+	return token, nil
 }
 
 // SignMessage 使用私钥对消息进行签名
 func SignMessage(message []byte, privateKeyHex string) (string, error) {
-	privateKey, err := crypto.HexToECDSA(privateKeyHex)
+	privateKey, err := ParsePrivateKey(privateKeyHex)
 	if err != nil {
-		return "", fmt.Errorf("解析私钥失败: %w", err)
+		return "", err
 	}
 
 	hash := crypto.Keccak256Hash(message)
@@ -79,9 +92,22 @@ func VerifySignature(message []byte, signatureHex string, publicKeyHex string) (
 	return matches, nil
 }
 
-// GenerateNonce 生成一个基于时间戳的nonce
+// lastNonce 是上一次生成的 nonce
+var lastNonce atomic.Int64
+
+// GenerateNonce 生成一个基于纳秒时间戳的 nonce。多个协程同时调用或时钟精度较低时时间戳可能相同，
+// 所以保证每次返回的值严格递增，同一进程内不会重复
 func GenerateNonce() string {
-	return fmt.Sprintf("%d", time.Now().UnixNano())
+	for {
+		last := lastNonce.Load()
+		nonce := time.Now().UnixNano()
+		if nonce <= last {
+			nonce = last + 1
+		}
+		if lastNonce.CompareAndSwap(last, nonce) {
+			return strconv.FormatInt(nonce, 10)
+		}
+	}
 }
 
 // SignRequest 对整个请求进行签名
@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestGenerateNonceUnique(t *testing.T) {
+	const goroutines, perGoroutine = 16, 1000
+	nonces := make(chan string, goroutines*perGoroutine)
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perGoroutine; j++ {
+				nonces <- GenerateNonce()
+			}
+		}()
+	}
+	wg.Wait()
+	close(nonces)
+
+	seen := make(map[string]bool, goroutines*perGoroutine)
+	for nonce := range nonces {
+		if _, err := strconv.ParseInt(nonce, 10, 64); err != nil {
+			t.Fatalf("nonce %q 不是整数", nonce)
+		}
+		if seen[nonce] {
+			t.Fatalf("nonce %s 重复", nonce)
+		}
+		seen[nonce] = true
+	}
+}
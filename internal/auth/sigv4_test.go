@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 以下用例来自 AWS Signature Version 4 测试套件（aws-sig-v4-test-suite），
+// 凭据、区域、服务和时间都是套件中的固定值
+var (
+	suiteCreds = AWSCredentials{
+		AccessKey: "AKIDEXAMPLE",
+		SecretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	suiteTime = time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+)
+
+const suiteEmptyHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+func TestSignV4Suite(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		url       string
+		signature string
+	}{
+		{"get-vanilla", "GET", "/", "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"},
+		{"get-vanilla-query-order-key-case", "GET", "/?Param2=value2&Param1=value1", "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500"},
+		{"post-vanilla", "POST", "/", "5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b"},
+		// 路径规范化：以下请求的规范路径都是 /，签名与 get-vanilla 相同
+		{"normalize-path/get-slash", "GET", "//", "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"},
+		{"normalize-path/get-slash-dot-slash", "GET", "/./", "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"},
+		{"normalize-path/get-relative-relative", "GET", "/example1/example2/../..", "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, "https://example.amazonaws.com"+tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("X-Amz-Date", "20150830T123600Z")
+			signV4(req, suiteEmptyHash, suiteCreds, "us-east-1", "service", suiteTime)
+
+			want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+				"SignedHeaders=host;x-amz-date, Signature=" + tt.signature
+			if got := req.Header.Get("Authorization"); got != want {
+				t.Errorf("Authorization =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+// TestSignV4IAM 是 AWS 文档中签名 IAM ListUsers 请求的示例
+func TestSignV4IAM(t *testing.T) {
+	req, err := http.NewRequest("GET", "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	req.Header.Set("X-Amz-Date", "20150830T123600Z")
+	signV4(req, suiteEmptyHash, suiteCreds, "us-east-1", "iam", suiteTime)
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, " +
+		"SignedHeaders=content-type;host;x-amz-date, " +
+		"Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCanonicalPath(t *testing.T) {
+	tests := []struct {
+		path    string
+		service string
+		want    string
+	}{
+		{"", "service", "/"},
+		{"/documents and settings/", "service", "/documents%2520and%2520settings/"},
+		{"/a//b/./c/../d", "service", "/a/b/d"},
+		{"/ሴ", "service", "/%25E1%2588%25B4"},
+		{"/documents and settings/", "s3", "/documents%20and%20settings/"},
+		{"/a//b", "s3", "/a//b"},
+	}
+	for _, tt := range tests {
+		u := &url.URL{Path: tt.path}
+		if got := canonicalPath(u, tt.service); got != tt.want {
+			t.Errorf("canonicalPath(%q, %s) = %q, want %q", tt.path, tt.service, got, tt.want)
+		}
+	}
+}
+
+// TestSignV4Headers 检查 SignV4 设置的请求头，以及会话令牌和请求体哈希参与签名
+func TestSignV4Headers(t *testing.T) {
+	creds := suiteCreds
+	creds.SessionToken = "session"
+	body := []byte(`{"a":1}`)
+	req, err := http.NewRequest("POST", "https://example.amazonaws.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SignV4(req, body, creds, "us-east-1", "service", suiteTime.In(time.FixedZone("CST", 8*3600)))
+
+	if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+		t.Errorf("X-Amz-Date = %q", got)
+	}
+	if got := req.Header.Get("X-Amz-Content-Sha256"); got != sha256Hex(body) {
+		t.Errorf("X-Amz-Content-Sha256 = %q", got)
+	}
+	if got := req.Header.Get("X-Amz-Security-Token"); got != "session" {
+		t.Errorf("X-Amz-Security-Token = %q", got)
+	}
+	if got := req.Header.Get("Authorization"); !strings.Contains(got, "SignedHeaders=host;x-amz-content-sha256;x-amz-date;x-amz-security-token,") {
+		t.Errorf("Authorization = %q", got)
+	}
+}
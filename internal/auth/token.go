@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Token 是一个访问令牌
+type Token struct {
+	AccessToken  string
+	RefreshToken string
+	// Expiry 为零值表示不过期
+	Expiry time.Time
+
+	// fetched 是 TokenCache 获取到该令牌的时间，用于计算令牌的有效期
+	fetched time.Time
+}
+
+// valid 返回令牌在 refreshBefore 之后是否仍然有效。refreshBefore 最多为令牌有效期的一半，
+// 否则有效期不长于 refreshBefore 的令牌每次都会被认为即将过期，所有请求都重新获取令牌
+func (t *Token) valid(refreshBefore time.Duration) bool {
+	if t == nil || t.AccessToken == "" {
+		return false
+	}
+	if t.Expiry.IsZero() {
+		return true
+	}
+	if !t.fetched.IsZero() {
+		if half := t.Expiry.Sub(t.fetched) / 2; refreshBefore > half {
+			refreshBefore = half
+		}
+	}
+	return time.Now().Add(refreshBefore).Before(t.Expiry)
+}
+
+// TokenCache 缓存一个令牌，在过期前 refreshBefore 时重新获取。可以被多个协程共用，
+// 同一时间只有一个协程获取令牌，其他协程等待结果。获取令牌期间不持有锁，
+// 等待的协程可以随时通过 ctx 退出
+type TokenCache struct {
+	mutex sync.Mutex
+	token *Token
+	// fetching 在有协程正在获取令牌时非空，获取结束后关闭
+	fetching chan struct{}
+}
+
+// Get 返回缓存的令牌，令牌不存在或即将过期时调用 fetch 获取新令牌。
+// fetch 的参数是当前令牌（可能为 nil），可以用其中的 RefreshToken 刷新。
+// 其他协程正在获取令牌时等待其结果，ctx 被取消时返回 ctx 的错误
+func (c *TokenCache) Get(ctx context.Context, refreshBefore time.Duration, fetch func(current *Token) (*Token, error)) (string, error) {
+	for {
+		c.mutex.Lock()
+		if c.token.valid(refreshBefore) {
+			token := c.token.AccessToken
+			c.mutex.Unlock()
+			return token, nil
+		}
+		if fetching := c.fetching; fetching != nil {
+			c.mutex.Unlock()
+			select {
+			case <-fetching:
+				// 获取失败时由下一个协程重新获取
+				continue
+			case <-ctx.Done():
+				return "", ctx.Err()
+			}
+		}
+		fetching := make(chan struct{})
+		c.fetching = fetching
+		current := c.token
+		c.mutex.Unlock()
+
+		token, err := fetch(current)
+
+		c.mutex.Lock()
+		if err == nil {
+			token.fetched = time.Now()
+			c.token = token
+		}
+		c.fetching = nil
+		close(fetching)
+		c.mutex.Unlock()
+		if err != nil {
+			return "", err
+		}
+		return token.AccessToken, nil
+	}
+}
+
+// Invalidate 在缓存的仍是 accessToken 时丢弃它，下次 Get 时重新获取。
+// 其他协程可能已经换了新令牌，这时不应丢弃新令牌
+func (c *TokenCache) Invalidate(accessToken string) {
+	c.mutex.Lock()
+	if c.token != nil && c.token.AccessToken == accessToken {
+		c.token = nil
+	}
+	c.mutex.Unlock()
+}
+
+// ClientCredentials 是 OAuth2 客户端凭据
+type ClientCredentials struct {
+	ClientID     string
+	ClientSecret string
+	// InBody 为 true 时把凭据放在表单中，否则使用 HTTP Basic 认证
+	InBody bool
+}
+
+// FetchToken 向 OAuth2 令牌端点请求令牌，form 是授权参数（grant_type 等）。
+// 响应中没有 expires_in 时令牌在 defaultTTL 后过期，defaultTTL 为 0 表示不过期。ctx 被取消时中止请求
+func FetchToken(ctx context.Context, client *http.Client, tokenURL string, form url.Values, creds ClientCredentials, defaultTTL time.Duration) (*Token, error) {
+	if creds.InBody && creds.ClientID != "" {
+		form.Set("client_id", creds.ClientID)
+		if creds.ClientSecret != "" {
+			form.Set("client_secret", creds.ClientSecret)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if !creds.InBody && creds.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(creds.ClientID), url.QueryEscape(creds.ClientSecret))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求令牌失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取令牌响应失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("请求令牌失败，状态码: %d，响应: %s", resp.StatusCode, body)
+	}
+
+	var tokenResp struct {
+		AccessToken  string      `json:"access_token"`
+		RefreshToken string      `json:"refresh_token"`
+		ExpiresIn    json.Number `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return nil, fmt.Errorf("解析令牌响应失败: %w", err)
+	}
+	if tokenResp.AccessToken == "" {
+		return nil, fmt.Errorf("令牌响应中未找到 access_token")
+	}
+
+	token := &Token{AccessToken: tokenResp.AccessToken, RefreshToken: tokenResp.RefreshToken}
+	if seconds, err := tokenResp.ExpiresIn.Int64(); err == nil && seconds > 0 {
+		token.Expiry = time.Now().Add(time.Duration(seconds) * time.Second)
+	} else if defaultTTL > 0 {
+		token.Expiry = time.Now().Add(defaultTTL)
+	}
+	return token, nil
+}
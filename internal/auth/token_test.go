@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTokenCacheSingleFetch(t *testing.T) {
+	var cache TokenCache
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	fetch := func(*Token) (*Token, error) {
+		fetches.Add(1)
+		<-release
+		return &Token{AccessToken: "t1", Expiry: time.Now().Add(time.Hour)}, nil
+	}
+
+	var wg sync.WaitGroup
+	tokens := make([]string, 8)
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			token, err := cache.Get(context.Background(), time.Minute, fetch)
+			if err != nil {
+				t.Error(err)
+			}
+			tokens[i] = token
+		}(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("fetch 调用了 %d 次，期望 1 次", n)
+	}
+	for i, token := range tokens {
+		if token != "t1" {
+			t.Errorf("协程 %d 得到令牌 %q", i, token)
+		}
+	}
+}
+
+// TestTokenCacheWaiterCancel 检查获取令牌卡住时，等待的协程可以通过 ctx 退出
+func TestTokenCacheWaiterCancel(t *testing.T) {
+	var cache TokenCache
+	release := make(chan struct{})
+	defer close(release)
+	go cache.Get(context.Background(), 0, func(*Token) (*Token, error) {
+		<-release
+		return nil, errors.New("unreachable")
+	})
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := cache.Get(ctx, 0, func(*Token) (*Token, error) {
+		t.Error("正在获取令牌时不应再次调用 fetch")
+		return nil, nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v，期望 context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("等待了 %v 才返回", elapsed)
+	}
+}
+
+func TestTokenCacheInvalidate(t *testing.T) {
+	var cache TokenCache
+	n := 0
+	fetch := func(*Token) (*Token, error) {
+		n++
+		return &Token{AccessToken: string(rune('a' + n - 1))}, nil
+	}
+	ctx := context.Background()
+	first, _ := cache.Get(ctx, 0, fetch)
+	// 丢弃旧令牌不应影响已经换上的新令牌
+	cache.Invalidate("other")
+	if token, _ := cache.Get(ctx, 0, fetch); token != first {
+		t.Errorf("Invalidate 其他令牌后得到 %q，期望 %q", token, first)
+	}
+	cache.Invalidate(first)
+	if token, _ := cache.Get(ctx, 0, fetch); token == first {
+		t.Errorf("Invalidate 后仍得到旧令牌 %q", token)
+	}
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// ParseTypedData 解析 EIP-712 结构化数据（eth_signTypedData_v4 的 JSON 格式）
+func ParseTypedData(data []byte) (apitypes.TypedData, error) {
+	var typedData apitypes.TypedData
+	if err := json.Unmarshal(data, &typedData); err != nil {
+		return typedData, fmt.Errorf("解析 EIP-712 数据失败: %w", err)
+	}
+	if typedData.PrimaryType == "" {
+		return typedData, fmt.Errorf("EIP-712 数据缺少 primaryType")
+	}
+	if _, ok := typedData.Types["EIP712Domain"]; !ok {
+		return typedData, fmt.Errorf("EIP-712 数据缺少 EIP712Domain 类型定义")
+	}
+	return typedData, nil
+}
+
+// HashTypedData 计算 EIP-712 结构化数据的签名哈希 keccak256("\x19\x01" ‖ domainSeparator ‖ hashStruct(message))
+func HashTypedData(data []byte) ([]byte, error) {
+	typedData, err := ParseTypedData(data)
+	if err != nil {
+		return nil, err
+	}
+	hash, _, err := apitypes.TypedDataAndHash(typedData)
+	if err != nil {
+		return nil, fmt.Errorf("计算 EIP-712 哈希失败: %w", err)
+	}
+	return hash, nil
+}
+
+// SignTypedData 按 eth_signTypedData_v4 对 EIP-712 结构化数据签名，V 为 27/28
+func SignTypedData(data []byte, privateKeyHex string) (string, error) {
+	privateKey, err := ParsePrivateKey(privateKeyHex)
+	if err != nil {
+		return "", err
+	}
+	hash, err := HashTypedData(data)
+	if err != nil {
+		return "", err
+	}
+
+	signature, err := crypto.Sign(hash, privateKey)
+	if err != nil {
+		return "", fmt.Errorf("签名失败: %w", err)
+	}
+	signature[64] += 27
+
+	return hexutil.Encode(signature), nil
+}
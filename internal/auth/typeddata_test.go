@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// mailTypedData 是 EIP-712 规范中的 Mail 示例
+const mailTypedData = `{
+	"types": {
+		"EIP712Domain": [
+			{"name": "name", "type": "string"},
+			{"name": "version", "type": "string"},
+			{"name": "chainId", "type": "uint256"},
+			{"name": "verifyingContract", "type": "address"}
+		],
+		"Person": [
+			{"name": "name", "type": "string"},
+			{"name": "wallet", "type": "address"}
+		],
+		"Mail": [
+			{"name": "from", "type": "Person"},
+			{"name": "to", "type": "Person"},
+			{"name": "contents", "type": "string"}
+		]
+	},
+	"primaryType": "Mail",
+	"domain": {
+		"name": "Ether Mail",
+		"version": "1",
+		"chainId": 1,
+		"verifyingContract": "0xCcCCccccCCCCcCCCCCCcCcCccCcCCCcCcccccccC"
+	},
+	"message": {
+		"from": {"name": "Cow", "wallet": "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826"},
+		"to": {"name": "Bob", "wallet": "0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB"},
+		"contents": "Hello, Bob!"
+	}
+}`
+
+// mailPrivateKey 是规范中签名 Mail 示例的私钥 keccak256("cow")
+var mailPrivateKey = hex.EncodeToString(crypto.Keccak256([]byte("cow")))
+
+func TestHashTypedData(t *testing.T) {
+	hash, err := HashTypedData([]byte(mailTypedData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "be609aee343fb3c4b28e1df9e632fca64fcfaede20f02e86244efddf30957bd2"
+	if got := hex.EncodeToString(hash); got != want {
+		t.Errorf("HashTypedData = %s, want %s", got, want)
+	}
+}
+
+func TestSignTypedData(t *testing.T) {
+	address, err := WalletAddress(mailPrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if address != "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826" {
+		t.Fatalf("私钥对应的地址 = %s，与规范中的 Cow 不一致", address)
+	}
+
+	signature, err := SignTypedData([]byte(mailTypedData), mailPrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "0x" +
+		"4355c47d63924e8a72e509b65029052eb6c299d53a04e167c5775fd466751c9d" +
+		"07299936d304c153f6443dfa05f40ff007d72911b6f72307f996231605b91562" +
+		"1c"
+	if signature != want {
+		t.Errorf("SignTypedData = %s, want %s", signature, want)
+	}
+}
+
+func TestParseTypedDataErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"invalid json", `{`},
+		{"missing primaryType", `{"types": {"EIP712Domain": []}}`},
+		{"missing EIP712Domain", `{"types": {"Mail": []}, "primaryType": "Mail"}`},
+	}
+	for _, tt := range tests {
+		if _, err := ParseTypedData([]byte(tt.data)); err == nil {
+			t.Errorf("%s: 期望返回错误", tt.name)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// LoginMessageTTL 是登录消息中过期时间距当前时间的长度，与 tool/wallet_tool.go 一致
+const LoginMessageTTL = 2 * time.Minute
+
+// privateKeys 缓存解析后的私钥，键为去掉 0x 前缀的十六进制私钥
+var privateKeys sync.Map
+
+// ParsePrivateKey 解析十六进制私钥，可以带 0x 前缀。解析结果会被缓存
+func ParsePrivateKey(privateKeyHex string) (*ecdsa.PrivateKey, error) {
+	privateKeyHex = strings.TrimPrefix(strings.TrimSpace(privateKeyHex), "0x")
+	if key, ok := privateKeys.Load(privateKeyHex); ok {
+		return key.(*ecdsa.PrivateKey), nil
+	}
+	key, err := crypto.HexToECDSA(privateKeyHex)
+	if err != nil {
+		return nil, fmt.Errorf("解析私钥失败: %w", err)
+	}
+	privateKeys.Store(privateKeyHex, key)
+	return key, nil
+}
+
+// PersonalSign 按 EIP-191 personal_sign 对消息签名，V 为 27/28，与 tool/wallet_tool.go 的 signMessage 一致
+func PersonalSign(message string, privateKeyHex string) (string, error) {
+	privateKey, err := ParsePrivateKey(privateKeyHex)
+	if err != nil {
+		return "", err
+	}
+
+	fullMessage := fmt.Sprintf("\x19Ethereum Signed Message:\n%d%s", len(message), message)
+	hash := crypto.Keccak256Hash([]byte(fullMessage))
+	signature, err := crypto.Sign(hash.Bytes(), privateKey)
+	if err != nil {
+		return "", fmt.Errorf("签名失败: %w", err)
+	}
+
+	signature[64] += 27 // 按黄皮书把 V 从 0/1 转换为 27/28
+
+	return hexutil.Encode(signature), nil
+}
+
+// WalletAddress 返回私钥对应的钱包地址（带校验和的十六进制形式）
+func WalletAddress(privateKeyHex string) (string, error) {
+	privateKey, err := ParsePrivateKey(privateKeyHex)
+	if err != nil {
+		return "", err
+	}
+	return crypto.PubkeyToAddress(privateKey.PublicKey).Hex(), nil
+}
+
+// LoginMessage 生成钱包登录的挑战消息，格式与 tool/wallet_tool.go 的 generateMessage 一致。
+// nonce 为空时使用 crypto/rand 生成的随机数，过期时间为当前时间之后 LoginMessageTTL
+func LoginMessage(nonce string) (string, error) {
+	if nonce == "" {
+		n, err := rand.Int(rand.Reader, big.NewInt(1000000000))
+		if err != nil {
+			return "", fmt.Errorf("生成 nonce 失败: %w", err)
+		}
+		nonce = n.String()
+	}
+	expirationTime := time.Now().UTC().Add(LoginMessageTTL).Format(time.RFC3339)
+
+	return fmt.Sprintf("Hello! airdrop.carv.io asks you to sign this message to confirm your ownership of the address. This action will not cost any gas fee. \n\nHere is a unique number: %s\n\nExpiration time: %s\n", nonce, expirationTime), nil
+}
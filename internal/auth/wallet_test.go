@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestLoginMessage(t *testing.T) {
+	msg, err := LoginMessage("42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(msg, "Here is a unique number: 42\n") {
+		t.Errorf("消息中没有指定的 nonce: %q", msg)
+	}
+
+	numberPattern := regexp.MustCompile(`unique number: (\d+)\n`)
+	seen := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		msg, err := LoginMessage("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		match := numberPattern.FindStringSubmatch(msg)
+		if match == nil {
+			t.Fatalf("消息中没有随机 nonce: %q", msg)
+		}
+		seen[match[1]] = true
+	}
+	if len(seen) < 19 {
+		t.Errorf("20 次生成只得到 %d 个不同的 nonce", len(seen))
+	}
+}
@@ -0,0 +1,98 @@
+package datasource
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf8"
+)
+
+// csvSource 流式读取 CSV 文件
+type csvSource struct {
+	cfg     Config
+	file    *os.File
+	reader  *csv.Reader
+	columns []string
+}
+
+func openCSV(cfg Config) (*csvSource, error) {
+	if cfg.NoHeader && len(cfg.Columns) == 0 {
+		return nil, fmt.Errorf("CSV 没有表头时必须通过 columns 指定列名")
+	}
+	if cfg.Delimiter != "" && utf8.RuneCountInString(cfg.Delimiter) != 1 {
+		return nil, fmt.Errorf("CSV 分隔符必须是单个字符: %q", cfg.Delimiter)
+	}
+
+	file, err := os.Open(cfg.Path)
+	if err != nil {
+		return nil, err
+	}
+	s := &csvSource{cfg: cfg, file: file}
+	if err := s.start(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// start 从文件开头创建读取器并读取表头
+func (s *csvSource) start() error {
+	s.reader = csv.NewReader(s.file)
+	s.reader.ReuseRecord = true
+	s.reader.LazyQuotes = s.cfg.LazyQuotes
+	// 允许各行字段数不同，缺少的列不会出现在数据行中
+	s.reader.FieldsPerRecord = -1
+	if s.cfg.Delimiter != "" {
+		s.reader.Comma, _ = utf8.DecodeRuneInString(s.cfg.Delimiter)
+	}
+
+	if s.cfg.NoHeader {
+		s.columns = s.cfg.Columns
+		return nil
+	}
+	header, err := s.reader.Read()
+	if errors.Is(err, io.EOF) {
+		// 空文件视为没有数据
+		s.columns = nil
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("读取 CSV 表头失败: %w", err)
+	}
+	s.columns = append([]string(nil), header...)
+	if len(s.cfg.Columns) > 0 {
+		s.columns = s.cfg.Columns
+	}
+	return nil
+}
+
+func (s *csvSource) Next() (Row, error) {
+	record, err := s.reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("读取 CSV 失败: %w", err)
+	}
+
+	row := make(Row, len(s.columns))
+	for i, value := range record {
+		if i < len(s.columns) {
+			row[s.columns[i]] = value
+		}
+	}
+	return row, nil
+}
+
+func (s *csvSource) Reset() error {
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return s.start()
+}
+
+func (s *csvSource) Close() error {
+	return s.file.Close()
+}
@@ -0,0 +1,115 @@
+// Package datasource 实现测试数据来源。所有实现都按行流式读取，
+// 不会把整个文件加载到内存中，适合百万行以上的数据集。
+package datasource
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Config 描述测试数据的来源。在 JSON 中可以直接写文件路径
+type Config struct {
+	// Path 是数据文件路径，相对于配置文件所在目录
+	Path string `json:"path"`
+	// Type 是数据格式：csv、jsonl、json（对象数组）或 sqlite，为空时按扩展名推断
+	Type string `json:"type"`
+	// Delimiter 是 CSV 的分隔符，默认为逗号
+	Delimiter string `json:"delimiter"`
+	// NoHeader 为 true 时 CSV 没有表头，列名由 Columns 指定
+	NoHeader bool     `json:"noHeader"`
+	Columns  []string `json:"columns"`
+	// LazyQuotes 为 true 时允许 CSV 字段中出现不成对的引号
+	LazyQuotes bool `json:"lazyQuotes"`
+	// Query 是 SQLite 的查询语句，为空时读取 Table 表的所有行
+	Query string `json:"query"`
+	Table string `json:"table"`
+	// RandomWindow 是 random 分发方式下在内存中保留的行数，默认 10000。
+	// 数据行数不超过该值时在全部数据中均匀抽样；否则只在窗口内抽样，
+	// 每行在读入窗口之前不会被取到，窗口内的行可能被连续取到多次
+	RandomWindow int `json:"randomWindow"`
+}
+
+func (c *Config) UnmarshalJSON(data []byte) error {
+	var path string
+	if err := json.Unmarshal(data, &path); err == nil {
+		*c = Config{Path: path}
+		return nil
+	}
+
+	type plain Config
+	return json.Unmarshal(data, (*plain)(c))
+}
+
+// Resolve 把相对路径转换为相对于 dir 的路径
+func (c *Config) Resolve(dir string) {
+	if c.Path != "" && !filepath.IsAbs(c.Path) {
+		c.Path = filepath.Join(dir, c.Path)
+	}
+}
+
+// Row 是一行测试数据，键为列名或字段名
+type Row = map[string]interface{}
+
+// DataSource 按行读取测试数据，不要求并发安全
+type DataSource interface {
+	// Next 返回下一行，没有更多数据时返回 io.EOF
+	Next() (Row, error)
+	// Reset 回到第一行，用于循环使用数据
+	Reset() error
+	Close() error
+}
+
+// Open 按配置打开数据来源，Type 为空时按扩展名推断格式
+func Open(cfg Config) (DataSource, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("数据来源缺少 path")
+	}
+
+	switch kind := sourceType(cfg); kind {
+	case "csv":
+		return openCSV(cfg)
+	case "jsonl":
+		return openJSONLines(cfg.Path)
+	case "json":
+		return openJSONArray(cfg.Path)
+	case "sqlite":
+		return openSQLite(cfg)
+	default:
+		return nil, fmt.Errorf("不支持的数据格式 %q", kind)
+	}
+}
+
+// Validate 打开数据来源并读取第一行，便于在测试开始前发现路径、格式或表头错误。
+// 空数据集不算错误
+func Validate(cfg Config) error {
+	src, err := Open(cfg)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if _, err := src.Next(); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+func sourceType(cfg Config) string {
+	if cfg.Type != "" {
+		return cfg.Type
+	}
+	switch strings.ToLower(filepath.Ext(cfg.Path)) {
+	case ".jsonl", ".ndjson":
+		return "jsonl"
+	case ".json":
+		return "json"
+	case ".db", ".sqlite", ".sqlite3":
+		return "sqlite"
+	default:
+		return "csv"
+	}
+}
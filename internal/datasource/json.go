@@ -0,0 +1,139 @@
+package datasource
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// jsonLinesSource 流式读取每行一个 JSON 对象的文件，空行会被跳过
+type jsonLinesSource struct {
+	file    *os.File
+	scanner *bufio.Scanner
+	line    int
+}
+
+// maxJSONLineSize 是 JSON Lines 单行的最大长度
+const maxJSONLineSize = 16 * 1024 * 1024
+
+func openJSONLines(path string) (*jsonLinesSource, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &jsonLinesSource{file: file}
+	s.start()
+	return s, nil
+}
+
+func (s *jsonLinesSource) start() {
+	s.scanner = bufio.NewScanner(s.file)
+	s.scanner.Buffer(make([]byte, 64*1024), maxJSONLineSize)
+	s.line = 0
+}
+
+func (s *jsonLinesSource) Next() (Row, error) {
+	for s.scanner.Scan() {
+		s.line++
+		line := bytes.TrimSpace(s.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		row, err := decodeRow(json.NewDecoder(bytes.NewReader(line)))
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 行: %w", s.line, err)
+		}
+		return row, nil
+	}
+	if err := s.scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取 JSON Lines 失败: %w", err)
+	}
+	return nil, io.EOF
+}
+
+func (s *jsonLinesSource) Reset() error {
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	s.start()
+	return nil
+}
+
+func (s *jsonLinesSource) Close() error {
+	return s.file.Close()
+}
+
+// jsonArraySource 流式读取顶层为对象数组的 JSON 文件，每次只解码一个元素
+type jsonArraySource struct {
+	file    *os.File
+	decoder *json.Decoder
+}
+
+func openJSONArray(path string) (*jsonArraySource, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &jsonArraySource{file: file}
+	if err := s.start(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// start 从文件开头读取到数组的起始括号
+func (s *jsonArraySource) start() error {
+	s.decoder = json.NewDecoder(bufio.NewReader(s.file))
+	s.decoder.UseNumber()
+	tok, err := s.decoder.Token()
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("解析 JSON 失败: %w", err)
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("JSON 测试数据的顶层必须是数组")
+	}
+	return nil
+}
+
+func (s *jsonArraySource) Next() (Row, error) {
+	if !s.decoder.More() {
+		return nil, io.EOF
+	}
+	row, err := decodeRow(s.decoder)
+	if err != nil {
+		return nil, err
+	}
+	return row, nil
+}
+
+func (s *jsonArraySource) Reset() error {
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return s.start()
+}
+
+func (s *jsonArraySource) Close() error {
+	return s.file.Close()
+}
+
+// decodeRow 解码一个 JSON 对象，数字保留为 json.Number
+func decodeRow(decoder *json.Decoder) (Row, error) {
+	decoder.UseNumber()
+	var row Row
+	if err := decoder.Decode(&row); err != nil {
+		return nil, fmt.Errorf("解析 JSON 对象失败: %w", err)
+	}
+	if row == nil {
+		return nil, fmt.Errorf("测试数据必须是 JSON 对象")
+	}
+	return row, nil
+}
@@ -0,0 +1,98 @@
+package datasource
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSource 用游标逐行读取 SQLite 查询结果
+type sqliteSource struct {
+	db      *sql.DB
+	query   string
+	rows    *sql.Rows
+	columns []string
+}
+
+func openSQLite(cfg Config) (*sqliteSource, error) {
+	query := cfg.Query
+	if query == "" {
+		if cfg.Table == "" {
+			return nil, fmt.Errorf("SQLite 数据来源必须指定 query 或 table")
+		}
+		query = fmt.Sprintf(`SELECT * FROM "%s"`, strings.ReplaceAll(cfg.Table, `"`, `""`))
+	}
+
+	// 路径中可能有 ?、# 或 %，要转义后再拼接 URI 参数
+	dsn := &url.URL{Scheme: "file", Path: filepath.ToSlash(cfg.Path), OmitHost: true, RawQuery: "mode=ro"}
+	db, err := sql.Open("sqlite", dsn.String())
+	if err != nil {
+		return nil, err
+	}
+	// 查询结果只在一个游标上顺序读取
+	db.SetMaxOpenConns(1)
+
+	s := &sqliteSource{db: db, query: query}
+	if err := s.start(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *sqliteSource) start() error {
+	rows, err := s.db.Query(s.query)
+	if err != nil {
+		return fmt.Errorf("执行 SQLite 查询失败: %w", err)
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		rows.Close()
+		return err
+	}
+	s.rows, s.columns = rows, columns
+	return nil
+}
+
+func (s *sqliteSource) Next() (Row, error) {
+	if !s.rows.Next() {
+		if err := s.rows.Err(); err != nil {
+			return nil, fmt.Errorf("读取 SQLite 失败: %w", err)
+		}
+		return nil, io.EOF
+	}
+
+	values := make([]interface{}, len(s.columns))
+	pointers := make([]interface{}, len(s.columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	if err := s.rows.Scan(pointers...); err != nil {
+		return nil, fmt.Errorf("读取 SQLite 失败: %w", err)
+	}
+
+	row := make(Row, len(s.columns))
+	for i, column := range s.columns {
+		if b, ok := values[i].([]byte); ok {
+			row[column] = string(b)
+		} else {
+			row[column] = values[i]
+		}
+	}
+	return row, nil
+}
+
+func (s *sqliteSource) Reset() error {
+	s.rows.Close()
+	return s.start()
+}
+
+func (s *sqliteSource) Close() error {
+	s.rows.Close()
+	return s.db.Close()
+}
@@ -0,0 +1,75 @@
+package report
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// writeCSV 输出每个 API 一行的汇总表，然后是工作流事务和全部请求；配置了场景时
+// 最后是每个场景的请求（scenario:名称）和工作流迭代（scenario:名称:workflow）
+func writeCSV(r *Report, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	header := []string{"schema_version", "name", "count", "success", "failed", "error_rate", "min_ms", "mean_ms", "max_ms"}
+	for _, p := range r.Summary.Percentiles {
+		header = append(header, "p"+formatFloat(p.Percentile)+"_ms")
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	total := Metrics{
+		Name:        "total",
+		Count:       r.Summary.TotalRequests,
+		Success:     r.Summary.SuccessRequests,
+		Failed:      r.Summary.FailedRequests,
+		ErrorRate:   r.Summary.ErrorRate,
+		MinMs:       r.Summary.MinMs,
+		MeanMs:      r.Summary.MeanMs,
+		MaxMs:       r.Summary.MaxMs,
+		Percentiles: r.Summary.Percentiles,
+	}
+	rows := append(append([]Metrics{}, r.APIs...), r.Transactions, total)
+	for _, sc := range r.Scenarios {
+		requests, iterations := sc.Requests, sc.Iterations
+		requests.Name = "scenario:" + sc.Name
+		iterations.Name = "scenario:" + sc.Name + ":workflow"
+		rows = append(rows, requests, iterations)
+	}
+	for _, m := range rows {
+		record := []string{
+			strconv.Itoa(r.SchemaVersion),
+			m.Name,
+			strconv.Itoa(m.Count),
+			strconv.Itoa(m.Success),
+			strconv.Itoa(m.Failed),
+			formatFloat(m.ErrorRate),
+			formatFloat(m.MinMs),
+			formatFloat(m.MeanMs),
+			formatFloat(m.MaxMs),
+		}
+		for _, p := range m.Percentiles {
+			record = append(record, formatFloat(p.ValueMs))
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("写入 CSV 失败: %w", err)
+	}
+	return nil
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
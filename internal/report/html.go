@@ -0,0 +1,241 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"math"
+	"os"
+	"strings"
+)
+
+const (
+	chartWidth    = 860
+	chartHeight   = 220
+	chartPadLeft  = 60
+	chartPadTop   = 20
+	chartPadBot   = 30
+	chartPadRight = 20
+)
+
+// chartSeries 是图表中的一条折线
+type chartSeries struct {
+	Name   string
+	Color  string
+	Values []float64
+}
+
+// lineChart 生成内联 SVG 折线图，报告不依赖任何外部脚本或样式即可离线查看
+func lineChart(title, unit string, xs []float64, series ...chartSeries) template.HTML {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<figure><figcaption>%s</figcaption>`, template.HTMLEscapeString(title))
+	fmt.Fprintf(&b, `<svg viewBox="0 0 %d %d" width="100%%" preserveAspectRatio="none" role="img">`, chartWidth, chartHeight)
+
+	plotWidth := float64(chartWidth - chartPadLeft - chartPadRight)
+	plotHeight := float64(chartHeight - chartPadTop - chartPadBot)
+
+	maxX := 0.0
+	for _, x := range xs {
+		maxX = math.Max(maxX, x)
+	}
+	maxY := 0.0
+	for _, s := range series {
+		for _, v := range s.Values {
+			maxY = math.Max(maxY, v)
+		}
+	}
+	if maxX == 0 {
+		maxX = 1
+	}
+	if maxY == 0 {
+		maxY = 1
+	}
+	maxY *= 1.1
+
+	// 坐标轴和刻度
+	for i := 0; i <= 4; i++ {
+		y := float64(chartPadTop) + plotHeight*float64(i)/4
+		value := maxY * float64(4-i) / 4
+		fmt.Fprintf(&b, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="#e5e5e5"/>`, chartPadLeft, y, chartWidth-chartPadRight, y)
+		fmt.Fprintf(&b, `<text x="%d" y="%.1f" font-size="11" text-anchor="end" fill="#666">%s%s</text>`, chartPadLeft-6, y+4, formatTick(value), unit)
+	}
+	for i := 0; i <= 5; i++ {
+		x := float64(chartPadLeft) + plotWidth*float64(i)/5
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d" font-size="11" text-anchor="middle" fill="#666">%ss</text>`, x, chartHeight-8, formatTick(maxX*float64(i)/5))
+	}
+
+	for _, s := range series {
+		points := make([]string, 0, len(s.Values))
+		for i, v := range s.Values {
+			x := float64(chartPadLeft) + xs[i]/maxX*plotWidth
+			y := float64(chartPadTop) + plotHeight - v/maxY*plotHeight
+			points = append(points, fmt.Sprintf("%.1f,%.1f", x, y))
+		}
+		fmt.Fprintf(&b, `<polyline fill="none" stroke="%s" stroke-width="1.5" points="%s"/>`, s.Color, strings.Join(points, " "))
+	}
+	b.WriteString(`</svg><div class="legend">`)
+	for _, s := range series {
+		fmt.Fprintf(&b, `<span><i style="background:%s"></i>%s</span>`, s.Color, template.HTMLEscapeString(s.Name))
+	}
+	b.WriteString(`</div></figure>`)
+	return template.HTML(b.String())
+}
+
+func formatTick(v float64) string {
+	switch {
+	case v >= 100:
+		return fmt.Sprintf("%.0f", v)
+	case v >= 10:
+		return fmt.Sprintf("%.1f", v)
+	default:
+		return fmt.Sprintf("%.2f", v)
+	}
+}
+
+type htmlData struct {
+	*Report
+	Charts []template.HTML
+	Config string
+}
+
+func writeHTML(r *Report, filename string) error {
+	xs := make([]float64, len(r.Timeline))
+	rps := make([]float64, len(r.Timeline))
+	errorRate := make([]float64, len(r.Timeline))
+	vus := make([]float64, len(r.Timeline))
+	p50 := make([]float64, len(r.Timeline))
+	p90 := make([]float64, len(r.Timeline))
+	p95 := make([]float64, len(r.Timeline))
+	p99 := make([]float64, len(r.Timeline))
+	for i, p := range r.Timeline {
+		xs[i] = p.OffsetSec
+		rps[i] = p.RPS
+		errorRate[i] = p.ErrorRate * 100
+		vus[i] = float64(p.ActiveVUs)
+		p50[i] = p.P50Ms
+		p90[i] = p.P90Ms
+		p95[i] = p.P95Ms
+		p99[i] = p.P99Ms
+	}
+
+	configJSON, err := json.MarshalIndent(r.Config, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	data := htmlData{
+		Report: r,
+		Charts: []template.HTML{
+			lineChart("每秒请求数", "", xs, chartSeries{Name: "RPS", Color: "#2b6cb0", Values: rps}),
+			lineChart("响应时间百分位", "ms", xs,
+				chartSeries{Name: "P50", Color: "#38a169", Values: p50},
+				chartSeries{Name: "P90", Color: "#d69e2e", Values: p90},
+				chartSeries{Name: "P95", Color: "#dd6b20", Values: p95},
+				chartSeries{Name: "P99", Color: "#e53e3e", Values: p99}),
+			lineChart("错误率", "%", xs, chartSeries{Name: "错误率", Color: "#e53e3e", Values: errorRate}),
+			lineChart("活跃虚拟用户", "", xs, chartSeries{Name: "VUs", Color: "#805ad5", Values: vus}),
+		},
+		Config: string(configJSON),
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return htmlTemplate.Execute(file, data)
+}
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"percent": func(f float64) string { return fmt.Sprintf("%.2f%%", f*100) },
+	"num":     func(f float64) string { return fmt.Sprintf("%.2f", f) },
+}).Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>GoLoadTest 测试报告</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", "PingFang SC", "Microsoft YaHei", sans-serif; margin: 24px auto; max-width: 960px; color: #222; }
+h1 { font-size: 24px; } h2 { font-size: 18px; margin-top: 32px; border-bottom: 1px solid #ddd; padding-bottom: 4px; }
+table { border-collapse: collapse; width: 100%; font-size: 13px; margin: 8px 0; }
+th, td { border: 1px solid #ddd; padding: 4px 8px; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+th { background: #f5f5f5; }
+.cards { display: flex; flex-wrap: wrap; gap: 12px; }
+.card { border: 1px solid #ddd; border-radius: 4px; padding: 8px 16px; min-width: 120px; }
+.card b { display: block; font-size: 20px; }
+figure { margin: 16px 0; } figcaption { font-weight: bold; margin-bottom: 4px; }
+.legend span { margin-right: 16px; font-size: 12px; }
+.legend i { display: inline-block; width: 10px; height: 10px; margin-right: 4px; }
+.fail { color: #c53030; }
+pre { background: #f7f7f7; padding: 12px; overflow: auto; font-size: 12px; }
+</style>
+</head>
+<body>
+<h1>GoLoadTest 测试报告</h1>
+<p>生成时间: {{.GeneratedAt.Format "2006-01-02 15:04:05 MST"}} · 报告格式版本 {{.SchemaVersion}}</p>
+
+<div class="cards">
+<div class="card">总请求数<b>{{.Summary.TotalRequests}}</b></div>
+<div class="card">失败请求<b{{if .Summary.FailedRequests}} class="fail"{{end}}>{{.Summary.FailedRequests}}</b></div>
+<div class="card">错误率<b>{{percent .Summary.ErrorRate}}</b></div>
+<div class="card">每秒请求数<b>{{num .Summary.RequestsPerSec}}</b></div>
+<div class="card">平均响应时间<b>{{num .Summary.MeanMs}} ms</b></div>
+<div class="card">运行时长<b>{{num .Summary.ElapsedMs}} ms</b></div>
+{{if .Summary.DroppedIterations}}<div class="card">丢弃迭代<b class="fail">{{.Summary.DroppedIterations}}</b></div>{{end}}
+{{if .Summary.LateIterations}}<div class="card">延迟启动迭代<b class="fail">{{.Summary.LateIterations}}</b></div>{{end}}
+</div>
+
+{{if .Thresholds}}<h2>阈值检查</h2>
+<table>
+<tr><th>指标</th><th>阈值</th><th>实际值</th><th>结果</th></tr>
+{{range .Thresholds}}<tr><td>{{.Metric}}</td><td>{{.Threshold}}</td><td>{{.Actual}}</td>{{if .NoData}}<td>无数据</td>{{else if .Passed}}<td>通过</td>{{else}}<td class="fail">未通过</td>{{end}}</tr>
+{{end}}</table>{{end}}
+
+<h2>时间序列</h2>
+{{range .Charts}}{{.}}{{end}}
+
+<h2>响应时间分布</h2>
+<table>
+<tr><th>百分位</th>{{range .Summary.Percentiles}}<th>P{{.Percentile}}</th>{{end}}</tr>
+<tr><td>全部请求 (ms)</td>{{range .Summary.Percentiles}}<td>{{num .ValueMs}}</td>{{end}}</tr>
+</table>
+
+<h2>按 API 统计</h2>
+<table>
+<tr><th>名称</th><th>总数</th><th>成功</th><th>失败</th><th>错误率</th><th>最小 (ms)</th><th>平均 (ms)</th><th>最大 (ms)</th>{{range .Summary.Percentiles}}<th>P{{.Percentile}} (ms)</th>{{end}}</tr>
+{{range .APIs}}<tr><td>{{.Name}}</td><td>{{.Count}}</td><td>{{.Success}}</td><td{{if .Failed}} class="fail"{{end}}>{{.Failed}}</td><td>{{percent .ErrorRate}}</td><td>{{num .MinMs}}</td><td>{{num .MeanMs}}</td><td>{{num .MaxMs}}</td>{{range .Percentiles}}<td>{{num .ValueMs}}</td>{{end}}</tr>
+{{end}}{{with .Transactions}}<tr><td><i>{{.Name}}</i></td><td>{{.Count}}</td><td>{{.Success}}</td><td{{if .Failed}} class="fail"{{end}}>{{.Failed}}</td><td>{{percent .ErrorRate}}</td><td>{{num .MinMs}}</td><td>{{num .MeanMs}}</td><td>{{num .MaxMs}}</td>{{range .Percentiles}}<td>{{num .ValueMs}}</td>{{end}}</tr>{{end}}
+</table>
+
+{{if .Scenarios}}<h2>按场景统计</h2>
+<table>
+<tr><th>场景</th><th>总数</th><th>成功</th><th>失败</th><th>错误率</th><th>最小 (ms)</th><th>平均 (ms)</th><th>最大 (ms)</th>{{range .Summary.Percentiles}}<th>P{{.Percentile}} (ms)</th>{{end}}</tr>
+{{range .Scenarios}}{{with .Requests}}<tr><td>{{.Name}}</td><td>{{.Count}}</td><td>{{.Success}}</td><td{{if .Failed}} class="fail"{{end}}>{{.Failed}}</td><td>{{percent .ErrorRate}}</td><td>{{num .MinMs}}</td><td>{{num .MeanMs}}</td><td>{{num .MaxMs}}</td>{{range .Percentiles}}<td>{{num .ValueMs}}</td>{{end}}</tr>{{end}}
+{{with .Iterations}}<tr><td><i>{{.Name}} (workflow)</i></td><td>{{.Count}}</td><td>{{.Success}}</td><td{{if .Failed}} class="fail"{{end}}>{{.Failed}}</td><td>{{percent .ErrorRate}}</td><td>{{num .MinMs}}</td><td>{{num .MeanMs}}</td><td>{{num .MaxMs}}</td>{{range .Percentiles}}<td>{{num .ValueMs}}</td>{{end}}</tr>{{end}}
+{{end}}</table>{{end}}
+
+{{if or .Summary.ChecksPassed .Summary.ChecksFailed}}<h2>断言统计</h2>
+<table>
+<tr><th>名称</th><th>断言</th><th>通过</th><th>失败</th></tr>
+{{range $api := .APIs}}{{range .Checks}}<tr><td>{{$api.Name}}</td><td>{{.Name}}</td><td>{{.Passes}}</td><td{{if .Fails}} class="fail"{{end}}>{{.Fails}}</td></tr>
+{{end}}{{end}}</table>{{end}}
+
+<h2>状态码分布</h2>
+<table>
+<tr><th>名称</th><th>状态码</th><th>次数</th></tr>
+{{range $api := .APIs}}{{range .StatusCodes}}<tr><td>{{$api.Name}}</td><td>{{.Code}}</td><td>{{.Count}}</td></tr>
+{{end}}{{end}}</table>
+
+<h2>错误类型分布</h2>
+{{if .Summary.ErrorTypes}}<table>
+<tr><th>名称</th><th>错误类型</th><th>次数</th></tr>
+{{range $api := .APIs}}{{range .ErrorTypes}}<tr><td>{{$api.Name}}</td><td>{{.Type}}</td><td>{{.Count}}</td></tr>
+{{end}}{{end}}</table>{{else}}<p>无错误</p>{{end}}
+
+<h2>生效配置</h2>
+<pre>{{.Config}}</pre>
+</body>
+</html>
+`))
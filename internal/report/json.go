@@ -0,0 +1,14 @@
+package report
+
+import (
+	"encoding/json"
+	"os"
+)
+
+func writeJSON(r *Report, filename string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(data, '\n'), 0644)
+}
@@ -0,0 +1,112 @@
+package report
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+)
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Time       float64         `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Properties []junitProperty `xml:"properties>property"`
+	Cases      []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnit 为每个 API 和每条阈值规则生成一个测试用例，有失败请求的 API 和未满足的阈值记为失败
+func writeJUnit(r *Report, filename string) error {
+	suite := junitTestSuite{
+		Name:      "goloadtest",
+		Time:      r.Summary.ElapsedMs / 1000,
+		Timestamp: r.GeneratedAt.Format("2006-01-02T15:04:05"),
+		Properties: []junitProperty{
+			{Name: "schemaVersion", Value: fmt.Sprint(r.SchemaVersion)},
+			{Name: "totalRequests", Value: fmt.Sprint(r.Summary.TotalRequests)},
+			{Name: "requestsPerSec", Value: formatFloat(r.Summary.RequestsPerSec)},
+		},
+	}
+
+	for _, m := range r.APIs {
+		tc := junitTestCase{
+			Name:      m.Name,
+			ClassName: "goloadtest.api",
+			Time:      m.MeanMs / 1000,
+		}
+		if m.Failed > 0 {
+			tc.Failure = &junitFailure{
+				Message: fmt.Sprintf("%d/%d 个请求失败", m.Failed, m.Count),
+				Type:    "RequestFailure",
+				Text:    formatErrorCounts(m.ErrorTypes),
+			}
+			suite.Failures++
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+	for _, t := range r.Thresholds {
+		tc := junitTestCase{
+			Name:      t.Metric + ": " + t.Threshold,
+			ClassName: "goloadtest.threshold",
+		}
+		switch {
+		case t.NoData:
+			tc.Skipped = &junitSkipped{Message: "指标没有数据，跳过检查"}
+			suite.Skipped++
+		case !t.Passed:
+			tc.Failure = &junitFailure{
+				Message: fmt.Sprintf("阈值未满足，实际值: %s", t.Actual),
+				Type:    "ThresholdFailure",
+			}
+			suite.Failures++
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+	suite.Tests = len(suite.Cases)
+
+	data, err := xml.MarshalIndent(junitTestSuites{Suites: []junitTestSuite{suite}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append([]byte(xml.Header), data...)
+	return os.WriteFile(filename, append(data, '\n'), 0644)
+}
+
+func formatErrorCounts(errorTypes []ErrorCount) string {
+	lines := make([]string, 0, len(errorTypes))
+	for _, e := range errorTypes {
+		lines = append(lines, fmt.Sprintf("%s: %d", e.Type, e.Count))
+	}
+	return strings.Join(lines, "\n")
+}
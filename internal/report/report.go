@@ -0,0 +1,334 @@
+package report
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tyxben/goloadtest/internal/stats"
+	"github.com/tyxben/goloadtest/internal/threshold"
+	"github.com/tyxben/goloadtest/pkg/config"
+)
+
+// SchemaVersion 是机器可读报告的格式版本，字段发生不兼容变化时递增
+const SchemaVersion = 1
+
+// Report 是测试结果的可序列化表示，所有列表都按固定顺序排列
+type Report struct {
+	SchemaVersion int            `json:"schemaVersion"`
+	GeneratedAt   time.Time      `json:"generatedAt"`
+	Summary       Summary        `json:"summary"`
+	APIs          []Metrics      `json:"apis"`
+	Transactions  Metrics        `json:"transactions"`
+	Scenarios     []Scenario     `json:"scenarios,omitempty"`
+	Phases        []Phase        `json:"phases"`
+	Timeline      []Point        `json:"timeline"`
+	Thresholds    []Threshold    `json:"thresholds"`
+	Config        *config.Config `json:"config,omitempty"`
+}
+
+// Threshold 是一条阈值规则的检查结果
+type Threshold struct {
+	Metric    string `json:"metric"`
+	Threshold string `json:"threshold"`
+	Actual    string `json:"actual"`
+	Passed    bool   `json:"passed"`
+	// NoData 为 true 表示指标没有数据，规则被跳过
+	NoData bool `json:"noData,omitempty"`
+}
+
+// Summary 是所有请求的汇总
+type Summary struct {
+	ElapsedMs         float64       `json:"elapsedMs"`
+	TotalRequests     int           `json:"totalRequests"`
+	SuccessRequests   int           `json:"successRequests"`
+	FailedRequests    int           `json:"failedRequests"`
+	ErrorRate         float64       `json:"errorRate"`
+	RequestsPerSec    float64       `json:"requestsPerSec"`
+	DroppedIterations int           `json:"droppedIterations"`
+	LateIterations    int           `json:"lateIterations"`
+	MinMs             float64       `json:"minMs"`
+	MeanMs            float64       `json:"meanMs"`
+	MaxMs             float64       `json:"maxMs"`
+	Percentiles       []Percentile  `json:"percentiles"`
+	StatusCodes       []StatusCount `json:"statusCodes"`
+	ErrorTypes        []ErrorCount  `json:"errorTypes"`
+	ChecksPassed      int           `json:"checksPassed"`
+	ChecksFailed      int           `json:"checksFailed"`
+	NewConnections    int           `json:"newConnections"`
+	ReusedConnections int           `json:"reusedConnections"`
+}
+
+// Phase 是一个请求阶段（dns、connect、tls、ttfb、transfer）的耗时统计
+type Phase struct {
+	Name        string       `json:"name"`
+	Count       int64        `json:"count"`
+	MeanMs      float64      `json:"meanMs"`
+	MaxMs       float64      `json:"maxMs"`
+	Percentiles []Percentile `json:"percentiles"`
+}
+
+// Metrics 是一个 API 或工作流事务的统计
+type Metrics struct {
+	Name        string        `json:"name"`
+	Count       int           `json:"count"`
+	Success     int           `json:"success"`
+	Failed      int           `json:"failed"`
+	ErrorRate   float64       `json:"errorRate"`
+	MinMs       float64       `json:"minMs"`
+	MeanMs      float64       `json:"meanMs"`
+	MaxMs       float64       `json:"maxMs"`
+	Percentiles []Percentile  `json:"percentiles"`
+	StatusCodes []StatusCount `json:"statusCodes"`
+	ErrorTypes  []ErrorCount  `json:"errorTypes"`
+	Checks      []CheckCount  `json:"checks"`
+}
+
+// Scenario 是一个场景的请求和工作流迭代统计
+type Scenario struct {
+	Name       string  `json:"name"`
+	Requests   Metrics `json:"requests"`
+	Iterations Metrics `json:"iterations"`
+}
+
+// CheckCount 是一项响应断言的通过和失败次数
+type CheckCount struct {
+	Name   string `json:"name"`
+	Passes int    `json:"passes"`
+	Fails  int    `json:"fails"`
+}
+
+// Point 是时间序列中的一个数据点，OffsetSec 为距测试开始的秒数
+type Point struct {
+	OffsetSec float64 `json:"offsetSec"`
+	Requests  int     `json:"requests"`
+	Failed    int     `json:"failed"`
+	RPS       float64 `json:"rps"`
+	ErrorRate float64 `json:"errorRate"`
+	P50Ms     float64 `json:"p50Ms"`
+	P90Ms     float64 `json:"p90Ms"`
+	P95Ms     float64 `json:"p95Ms"`
+	P99Ms     float64 `json:"p99Ms"`
+	ActiveVUs int     `json:"activeVUs"`
+}
+
+type Percentile struct {
+	Percentile float64 `json:"percentile"`
+	ValueMs    float64 `json:"valueMs"`
+}
+
+type StatusCount struct {
+	Code  int `json:"code"`
+	Count int `json:"count"`
+}
+
+type ErrorCount struct {
+	Type  string `json:"type"`
+	Count int    `json:"count"`
+}
+
+// writers 按输出类型注册报告写入函数
+var writers = map[string]func(r *Report, filename string) error{
+	"json":  writeJSON,
+	"csv":   writeCSV,
+	"junit": writeJUnit,
+	"html":  writeHTML,
+}
+
+// Build 根据统计结果和阈值检查结果生成报告
+func Build(s *stats.Stats, cfg *config.Config, thresholds []threshold.Result) *Report {
+	r := &Report{
+		SchemaVersion: SchemaVersion,
+		GeneratedAt:   time.Now().UTC(),
+		Summary: Summary{
+			ElapsedMs:         ms(s.Elapsed),
+			TotalRequests:     s.TotalRequests,
+			SuccessRequests:   s.SuccessRequests,
+			FailedRequests:    s.FailedRequests,
+			ErrorRate:         rate(s.FailedRequests, s.TotalRequests),
+			RequestsPerSec:    s.RequestsPerSec,
+			DroppedIterations: s.DroppedIterations,
+			LateIterations:    s.LateIterations,
+			MinMs:             ms(s.Latency.Min()),
+			MeanMs:            ms(s.Latency.Mean()),
+			MaxMs:             ms(s.Latency.Max()),
+			Percentiles:       percentiles(s.Latency, s.PercentileTargets()),
+			StatusCodes:       statusCounts(s.StatusCodes),
+			ErrorTypes:        errorCounts(s.ErrorTypes),
+			ChecksPassed:      s.ChecksPassed,
+			ChecksFailed:      s.ChecksFailed,
+			NewConnections:    s.Phases.NewConns,
+			ReusedConnections: s.Phases.ReusedConns,
+		},
+		Transactions: buildMetrics("workflow", s.Transactions, s.PercentileTargets()),
+		Config:       cfg.Redacted(),
+	}
+
+	names := make([]string, 0, len(s.APIs))
+	for name := range s.APIs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	r.APIs = make([]Metrics, 0, len(names))
+	for _, name := range names {
+		r.APIs = append(r.APIs, buildMetrics(name, s.APIs[name], s.PercentileTargets()))
+	}
+
+	scenarios := make([]string, 0, len(s.Scenarios))
+	for name := range s.Scenarios {
+		scenarios = append(scenarios, name)
+	}
+	sort.Strings(scenarios)
+	for _, name := range scenarios {
+		sm := s.Scenarios[name]
+		r.Scenarios = append(r.Scenarios, Scenario{
+			Name:       name,
+			Requests:   buildMetrics(name, sm.Requests, s.PercentileTargets()),
+			Iterations: buildMetrics(name, sm.Iterations, s.PercentileTargets()),
+		})
+	}
+
+	r.Phases = make([]Phase, 0, len(stats.PhaseNames))
+	for _, name := range stats.PhaseNames {
+		h := s.Phases.Latency[name]
+		r.Phases = append(r.Phases, Phase{
+			Name:        name,
+			Count:       h.Count(),
+			MeanMs:      ms(h.Mean()),
+			MaxMs:       ms(h.Max()),
+			Percentiles: percentiles(h, s.PercentileTargets()),
+		})
+	}
+
+	r.Thresholds = make([]Threshold, 0, len(thresholds))
+	for _, t := range thresholds {
+		r.Thresholds = append(r.Thresholds, Threshold{
+			Metric:    t.Metric,
+			Threshold: t.Threshold,
+			Actual:    t.Actual,
+			Passed:    t.Passed,
+			NoData:    t.NoData,
+		})
+	}
+
+	r.Timeline = make([]Point, 0, len(s.Timeline.Points))
+	for _, p := range s.Timeline.Points {
+		r.Timeline = append(r.Timeline, Point{
+			OffsetSec: p.Offset.Seconds(),
+			Requests:  p.Requests,
+			Failed:    p.Failed,
+			RPS:       p.RPS,
+			ErrorRate: p.ErrorRate,
+			P50Ms:     ms(p.P50),
+			P90Ms:     ms(p.P90),
+			P95Ms:     ms(p.P95),
+			P99Ms:     ms(p.P99),
+			ActiveVUs: p.ActiveVUs,
+		})
+	}
+	return r
+}
+
+// Validate 检查输出目标的格式，便于在测试开始前发现配置错误
+func Validate(outputs []string) error {
+	for _, output := range outputs {
+		if _, _, err := parseOutput(output); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write 把报告写入每个输出目标，目标格式为 "类型:文件路径"
+func Write(outputs []string, r *Report) error {
+	for _, output := range outputs {
+		kind, filename, err := parseOutput(output)
+		if err != nil {
+			return err
+		}
+		if err := writers[kind](r, filename); err != nil {
+			return fmt.Errorf("写入 %s 报告失败: %w", kind, err)
+		}
+		fmt.Fprintf(os.Stderr, "%s 报告已写入 %s\n", kind, filename)
+	}
+	return nil
+}
+
+func parseOutput(output string) (kind, filename string, err error) {
+	kind, filename, ok := strings.Cut(output, ":")
+	if !ok || filename == "" {
+		return "", "", fmt.Errorf("无效的输出目标 %q，格式应为 类型:文件路径", output)
+	}
+	if _, ok := writers[kind]; !ok {
+		return "", "", fmt.Errorf("不支持的输出类型 %q", kind)
+	}
+	return kind, filename, nil
+}
+
+func buildMetrics(name string, m *stats.Metrics, targets []float64) Metrics {
+	return Metrics{
+		Name:        name,
+		Count:       m.Count,
+		Success:     m.Success,
+		Failed:      m.Failed,
+		ErrorRate:   rate(m.Failed, m.Count),
+		MinMs:       ms(m.Latency.Min()),
+		MeanMs:      ms(m.Latency.Mean()),
+		MaxMs:       ms(m.Latency.Max()),
+		Percentiles: percentiles(m.Latency, targets),
+		StatusCodes: statusCounts(m.StatusCodes),
+		ErrorTypes:  errorCounts(m.ErrorTypes),
+		Checks:      checkCounts(m.Checks),
+	}
+}
+
+func checkCounts(checks map[string]*stats.CheckCount) []CheckCount {
+	out := make([]CheckCount, 0, len(checks))
+	for name, count := range checks {
+		out = append(out, CheckCount{Name: name, Passes: count.Passes, Fails: count.Fails})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func percentiles(h *stats.Histogram, targets []float64) []Percentile {
+	sorted := append([]float64(nil), targets...)
+	sort.Float64s(sorted)
+
+	out := make([]Percentile, 0, len(sorted))
+	for _, p := range sorted {
+		out = append(out, Percentile{Percentile: p, ValueMs: ms(h.Percentile(p))})
+	}
+	return out
+}
+
+func statusCounts(codes map[int]int) []StatusCount {
+	out := make([]StatusCount, 0, len(codes))
+	for code, count := range codes {
+		out = append(out, StatusCount{Code: code, Count: count})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Code < out[j].Code })
+	return out
+}
+
+func errorCounts(errorTypes map[string]int) []ErrorCount {
+	out := make([]ErrorCount, 0, len(errorTypes))
+	for errType, count := range errorTypes {
+		out = append(out, ErrorCount{Type: errType, Count: count})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Type < out[j].Type })
+	return out
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func rate(failed, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(failed) / float64(total)
+}
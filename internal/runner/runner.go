@@ -1,11 +1,17 @@
 package runner
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"math"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/tyxben/goloadtest/internal/stats"
+	"github.com/tyxben/goloadtest/internal/threshold"
 	"github.com/tyxben/goloadtest/internal/worker"
 	"github.com/tyxben/goloadtest/pkg/config"
 )
@@ -13,34 +19,112 @@ import (
 type Runner struct {
 	Config *config.Config
 	Stats  *stats.Stats
+	// Aborted 为 true 表示测试因 abortOnFail 阈值不满足而被提前中止
+	Aborted bool
+	// Interrupted 为 true 表示测试因收到信号而被提前停止，统计结果只包含停止前的部分
+	Interrupted bool
+
+	// dropped 记录开放模型下因达到 MaxConcurrency 而未能启动的迭代数
+	dropped int64
+	// late 记录开放模型下实际开始时间比计划时间晚 lateStartThreshold 以上的迭代数
+	late int64
+	// active 是当前存活的工作协程（虚拟用户）数
+	active int64
+	// datasets 是所有场景共用的命名数据集
+	datasets *worker.Datasets
 }
 
+// defaultProgressInterval 是未配置 progressInterval 时输出进度的间隔
+const defaultProgressInterval = 5 * time.Second
+
+// defaultGracefulStop 是未配置 gracefulStop 时测试被中断后等待进行中迭代的时间
+const defaultGracefulStop = 30 * time.Second
+
 func NewRunner(cfg *config.Config) *Runner {
 	return &Runner{
 		Config: cfg,
-		Stats:  stats.NewStats(),
+		Stats:  stats.NewStats(cfg.HistogramPrecision, cfg.Percentiles),
 	}
 }
 
-func (r *Runner) Run() {
+// Run 执行 setup、负载测试和 teardown。测试数据打开失败或 setup 失败时不执行负载测试，返回错误；teardown 总会执行。
+// ctx 被取消时停止派发新的迭代，等待进行中的迭代最多 gracefulStop 后中止它们，统计已收集的结果
+func (r *Runner) Run(ctx context.Context) error {
 	log.Println("开始运行测试...")
-	tasks := make(chan struct{}, r.Config.Concurrency)
 	results := make(chan worker.Result)
+	// ctx 停止派发新的迭代，work 中止进行中的请求
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	work, cancelWork := context.WithCancel(context.Background())
+	defer cancelWork()
 
-	testDataQueue := worker.NewTestDataQueue(r.Config.TestData)
+	globals := make(map[string]interface{})
+	defer r.teardown(globals)
 
-	var wg sync.WaitGroup
-	for i := 0; i < r.Config.Concurrency; i++ {
-		wg.Add(1)
-		go func(index int) {
-			defer wg.Done()
-			log.Printf("启动工作协程 #%d", index)
-			worker.Run(r.Config, tasks, results, testDataQueue)
-		}(i)
+	// 没有专用测试数据和分发方式的场景共用同一个队列
+	scenarios := r.Config.ScenarioConfigs()
+	queues := make([]*worker.TestDataQueue, len(scenarios))
+	var opened []*worker.TestDataQueue
+	closeData := func() {
+		for _, queue := range opened {
+			if err := queue.Close(); err != nil {
+				log.Printf("关闭测试数据失败: %v", err)
+			}
+		}
+		if err := r.datasets.Close(); err != nil {
+			log.Printf("关闭数据集失败: %v", err)
+		}
+	}
+	sharedQueue, err := worker.OpenTestDataQueue(r.Config)
+	if err != nil {
+		return err
+	}
+	opened = append(opened, sharedQueue)
+	for i, cfg := range scenarios {
+		queues[i] = sharedQueue
+		if cfg.Scenario == "" {
+			continue
+		}
+		if sc := r.Config.Scenarios[i]; sc.TestData != nil || sc.TestDataPolicy != nil {
+			if queues[i], err = worker.OpenTestDataQueue(cfg); err != nil {
+				closeData()
+				return fmt.Errorf("场景 %s: %w", cfg.Scenario, err)
+			}
+			opened = append(opened, queues[i])
+		}
+	}
+	if r.datasets, err = worker.OpenDatasets(r.Config.Datasets); err != nil {
+		closeData()
+		return err
 	}
 
-	// 启动任务生成器
-	go r.generateTasks(tasks)
+	if len(r.Config.Setup) > 0 {
+		log.Println("执行 setup...")
+		// setup 期间收到信号时立即中止 setup，不等待 gracefulStop
+		if err := worker.RunPhase(ctx, "setup", r.Config, r.Config.Setup, r.datasets, globals); err != nil {
+			closeData()
+			if parent.Err() != nil {
+				r.Interrupted = true
+			}
+			return fmt.Errorf("setup 失败: %w", err)
+		}
+	}
+	// 场景配置是 r.Config 的副本，要在拆分前设置
+	r.Config.Globals = globals
+	// 负载从 setup 结束后开始计时，setup 的耗时不计入吞吐量、时间序列和进度
+	startTime := time.Now()
+	r.Stats.Start(startTime)
+	finished := make(chan struct{})
+	go r.gracefulStop(ctx, finished, cancelWork)
+
+	var wg sync.WaitGroup
+	for i, cfg := range r.Config.ScenarioConfigs() {
+		if cfg.Scenario != "" {
+			log.Printf("启动场景 %s", cfg.Scenario)
+		}
+		r.start(ctx, work, cfg, results, queues[i], &wg)
+	}
 
 	// 启动结果收集器
 	go func() {
@@ -51,37 +135,335 @@ func (r *Runner) Run() {
 
 	// 收集结果
 	log.Println("开始收集结果...")
-	startTime := time.Now()
-	for result := range results {
-		r.Stats.AddResult(result)
-	}
+	r.collect(results, cancel, startTime)
+	close(finished)
 	duration := time.Since(startTime)
-	log.Printf("测试完成，总耗时: %v", duration)
+	if parent.Err() != nil {
+		r.Interrupted = true
+		log.Printf("测试被中断，总耗时: %v", duration)
+	} else {
+		log.Printf("测试完成，总耗时: %v", duration)
+	}
+
+	closeData()
 
 	// 计算最终统计信息
+	r.Stats.DroppedIterations = int(atomic.LoadInt64(&r.dropped))
+	r.Stats.LateIterations = int(atomic.LoadInt64(&r.late))
 	r.Stats.CalculateStats(duration)
+	return nil
+}
+
+// gracefulStop 在 ctx 被取消（测试被中断或中止）后等待 gracefulStop，
+// 进行中的迭代到时仍未结束则调用 cancelWork 中止它们。finished 关闭表示所有迭代已经结束
+func (r *Runner) gracefulStop(ctx context.Context, finished <-chan struct{}, cancelWork context.CancelFunc) {
+	select {
+	case <-ctx.Done():
+	case <-finished:
+		return
+	}
+
+	grace := r.Config.GracefulStop.Std()
+	if grace <= 0 {
+		grace = defaultGracefulStop
+	}
+	log.Printf("停止派发新的迭代，最多等待 %v 让进行中的迭代结束", grace)
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		log.Println("等待超时，中止进行中的请求")
+		cancelWork()
+	case <-finished:
+	}
+}
+
+// teardown 执行 teardown，可以引用 setup 产生的变量。失败只输出日志，不影响测试结果
+func (r *Runner) teardown(globals map[string]interface{}) {
+	if len(r.Config.Teardown) == 0 {
+		return
+	}
+	log.Println("执行 teardown...")
+	sessionData := make(map[string]interface{}, len(globals))
+	for key, value := range globals {
+		sessionData[key] = value
+	}
+	// 测试被中断时 teardown 也要完整执行，所以不使用测试的 ctx
+	if err := worker.RunPhase(context.Background(), "teardown", r.Config, r.Config.Teardown, nil, sessionData); err != nil {
+		log.Printf("teardown 失败: %v", err)
+	}
+}
+
+// start 按 cfg 的负载模型启动工作协程和任务生成器，所有协程都计入 wg。
+// ctx 被取消或测试数据用完时停止派发新的迭代，work 被取消时工作协程中止进行中的请求
+func (r *Runner) start(ctx, work context.Context, cfg *config.Config, results chan<- worker.Result, testDataQueue *worker.TestDataQueue, wg *sync.WaitGroup) {
+	ctx, stop := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-testDataQueue.Done():
+			log.Println("测试数据已用完，停止派发新的迭代")
+			stop()
+		case <-ctx.Done():
+		}
+	}()
+	// 只有该场景引用的数据集用完时才停止该场景
+	for _, name := range r.datasets.Used(cfg) {
+		go func(name string) {
+			select {
+			case <-r.datasets.Done(name):
+				log.Printf("数据集 %s 已用完，停止派发新的迭代", name)
+				stop()
+			case <-ctx.Done():
+			}
+		}(name)
+	}
+
+	switch {
+	case cfg.Rate > 0:
+		// 开放模型：任务生成器按计划派发迭代，必要时追加工作协程
+		tasks := make(chan struct{})
+		startWorker := func(index int) {
+			log.Printf("启动工作协程 #%d", index)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer r.trackWorker()()
+				worker.Run(ctx, work, cfg, tasks, results, testDataQueue, r.datasets)
+			}()
+		}
+		for i := 0; i < cfg.Concurrency; i++ {
+			startWorker(i)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.generateArrivals(ctx, cfg, tasks, startWorker)
+		}()
+	case len(cfg.Stages) > 0:
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.runStages(ctx, work, cfg, results, testDataQueue, wg)
+		}()
+	default:
+		tasks := make(chan struct{}, cfg.Concurrency)
+		for i := 0; i < cfg.Concurrency; i++ {
+			wg.Add(1)
+			go func(index int) {
+				defer wg.Done()
+				defer r.trackWorker()()
+				log.Printf("启动工作协程 #%d", index)
+				worker.Run(ctx, work, cfg, tasks, results, testDataQueue, r.datasets)
+			}(i)
+		}
+
+		// 启动任务生成器
+		go r.generateTasks(ctx, cfg, tasks)
+	}
+}
+
+// collect 从结果通道读取结果直到通道关闭，按秒记录时间序列并检查 abortOnFail 阈值，
+// 按 progressInterval 周期性输出进度。阈值不满足时调用 abort 停止派发新的迭代。
+// startTime 是负载阶段开始的时间
+func (r *Runner) collect(results <-chan worker.Result, abort context.CancelFunc, startTime time.Time) {
+	timelineTicker := time.NewTicker(stats.TimelineInterval)
+	defer timelineTicker.Stop()
+
+	interval := r.Config.ProgressInterval.Std()
+	if interval == 0 {
+		interval = defaultProgressInterval
+	}
+	var progress *stats.Progress
+	var progressTick <-chan time.Time
+	if interval > 0 {
+		progress = stats.NewProgress(os.Stderr, r.Config.HistogramPrecision, startTime)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		progressTick = ticker.C
+	}
+
+	for {
+		select {
+		case result, ok := <-results:
+			if !ok {
+				r.Stats.Timeline.Flush(int(atomic.LoadInt64(&r.active)))
+				if progress != nil {
+					progress.Summary()
+				}
+				return
+			}
+			r.Stats.AddResult(result)
+			if progress != nil {
+				progress.Observe(result)
+			}
+		case <-timelineTicker.C:
+			r.Stats.Timeline.Flush(int(atomic.LoadInt64(&r.active)))
+			if !r.Aborted {
+				if failed, ok := threshold.CheckAbort(r.Config.Thresholds, r.Stats, time.Since(startTime)); ok {
+					log.Printf("阈值 %s: %s 未满足（实际值: %s），中止测试", failed.Metric, failed.Threshold, failed.Actual)
+					r.Aborted = true
+					abort()
+				}
+			}
+		case <-progressTick:
+			progress.Report(int(atomic.LoadInt64(&r.active)))
+		}
+	}
+}
+
+// trackWorker 把调用它的工作协程计入活跃数，返回的函数在协程退出时调用
+func (r *Runner) trackWorker() func() {
+	atomic.AddInt64(&r.active, 1)
+	return func() {
+		atomic.AddInt64(&r.active, -1)
+	}
 }
 
-func (r *Runner) generateTasks(tasks chan<- struct{}) {
+func (r *Runner) generateTasks(ctx context.Context, cfg *config.Config, tasks chan<- struct{}) {
 	log.Println("开始生成任务...")
-	startTime := time.Now()
 
-	if r.Config.TotalRequests > 0 {
+	if cfg.TotalRequests > 0 {
 		// 按照指定次数生成任务
-		for i := 0; i < r.Config.TotalRequests; i++ {
-			tasks <- struct{}{}
+	count:
+		for i := 0; i < cfg.TotalRequests; i++ {
+			select {
+			case tasks <- struct{}{}:
+			case <-ctx.Done():
+				break count
+			}
 		}
 	} else {
-		// 按照持续时间生成任务
-		for time.Since(startTime) < time.Duration(r.Config.Duration)*time.Second {
+		// 按照持续时间生成任务，通道已满时阻塞等待空闲的工作协程
+		deadline := time.NewTimer(time.Duration(cfg.Duration) * time.Second)
+		defer deadline.Stop()
+	loop:
+		for {
+			select {
+			case tasks <- struct{}{}:
+			case <-deadline.C:
+				break loop
+			case <-ctx.Done():
+				break loop
+			}
+		}
+	}
+
+	close(tasks)
+	log.Println("任务生成完成，关闭任务通道")
+}
+
+// lateStartThreshold 是开放模型下迭代实际开始时间晚于计划时间多少时计为延迟启动
+const lateStartThreshold = 10 * time.Millisecond
+
+// generateArrivals 按 Rate 指定的到达速率派发迭代。迭代的计划时间由到达速率对时间的积分得到（见 nextArrival），
+// 不受响应时间影响；配置了 Stages 时速率随阶段线性变化。
+// 没有空闲工作协程时追加新的协程，协程数达到 MaxConcurrency 后该次迭代计为丢弃。
+// 丢弃的迭代不计入 TotalRequests，所以请求总数模式下实际执行的迭代数总是 TotalRequests（除非测试被中断）。
+// 任务通道没有缓冲，发送成功时工作协程已经开始执行该迭代，发送完成时刻晚于计划时刻
+// lateStartThreshold 以上的迭代计为延迟启动（如等待新协程启动或调度器过载）
+func (r *Runner) generateArrivals(ctx context.Context, cfg *config.Config, tasks chan<- struct{}, startWorker func(index int)) {
+	log.Printf("开始按 %.2f 次/秒 的速率生成任务...", cfg.Rate)
+
+	maxConcurrency := cfg.MaxConcurrency
+	if maxConcurrency < cfg.Concurrency {
+		maxConcurrency = cfg.Concurrency
+	}
+	active := cfg.Concurrency
+	total := cfg.TotalRequests
+	if len(cfg.Stages) > 0 {
+		total = 0
+	}
+
+	timer := time.NewTimer(0)
+	if !timer.Stop() {
+		<-timer.C
+	}
+	startTime := time.Now()
+	// 第一次迭代在开始时立即派发，起始速率为 0 时等到速率积分到 1
+	elapsed, ok := time.Duration(0), true
+	if rate, _ := rateAt(cfg, 0); rate <= 0 {
+		elapsed, ok = nextArrival(cfg, 0)
+	}
+loop:
+	for dispatched := 0; ok && (total <= 0 || dispatched < total); elapsed, ok = nextArrival(cfg, elapsed) {
+		if wait := time.Until(startTime.Add(elapsed)); wait > 0 {
+			timer.Reset(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				break loop
+			}
+		} else if ctx.Err() != nil {
+			break
+		}
+		scheduled := startTime.Add(elapsed)
+
+		select {
+		case tasks <- struct{}{}:
+		default:
+			if active >= maxConcurrency {
+				atomic.AddInt64(&r.dropped, 1)
+				continue
+			}
+			startWorker(active)
+			active++
 			select {
 			case tasks <- struct{}{}:
-			default:
-				// Channel 已满，跳过本次发送
+			case <-ctx.Done():
+				break loop
 			}
 		}
+		dispatched++
+		if time.Since(scheduled) > lateStartThreshold {
+			atomic.AddInt64(&r.late, 1)
+		}
 	}
 
 	close(tasks)
 	log.Println("任务生成完成，关闭任务通道")
 }
+
+// nextArrival 返回 from 之后下一次迭代的计划时刻，即到达速率从 from 开始积分到 1 的时刻。
+// 速率按 stageTick 分段、段内按线性变化积分，所以爬坡阶段的到达间隔跟随速率变化，
+// 速率接近 0 的阶段也不会一次跳过后面的阶段。测试在下一次到达前结束时 ok 为 false
+func nextArrival(cfg *config.Config, from time.Duration) (next time.Duration, ok bool) {
+	need := 1.0
+	step := stageTick.Seconds()
+	for t := from; ; t += stageTick {
+		r0, ok := rateAt(cfg, t)
+		if !ok {
+			return 0, false
+		}
+		r1, ok := rateAt(cfg, t+stageTick)
+		if !ok {
+			r1 = r0
+		}
+		area := (r0 + r1) / 2 * step
+		if area < need {
+			need -= area
+			continue
+		}
+		// 解 r0*dt + slope*dt²/2 = need，写成这种形式在 slope 接近 0 时没有精度损失
+		slope := (r1 - r0) / step
+		dt := 2 * need / (r0 + math.Sqrt(math.Max(r0*r0+2*slope*need, 0)))
+		next = t + time.Duration(dt*float64(time.Second))
+		if _, ok := rateAt(cfg, next); !ok {
+			return 0, false
+		}
+		return next, true
+	}
+}
+
+// rateAt 返回开始后 elapsed 时刻的到达速率，测试应当结束时 ok 为 false
+func rateAt(cfg *config.Config, elapsed time.Duration) (rate float64, ok bool) {
+	switch {
+	case len(cfg.Stages) > 0:
+		return stageTarget(cfg.Stages, cfg.Rate, elapsed)
+	case cfg.TotalRequests > 0:
+		return cfg.Rate, true
+	default:
+		return cfg.Rate, elapsed < time.Duration(cfg.Duration)*time.Second
+	}
+}
@@ -0,0 +1,91 @@
+package runner
+
+import (
+	"context"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/tyxben/goloadtest/internal/worker"
+	"github.com/tyxben/goloadtest/pkg/config"
+)
+
+// stageTick 是阶段模式下重新计算目标值的间隔
+const stageTick = 100 * time.Millisecond
+
+// stageTarget 返回从 start 出发、经过 elapsed 后按阶段线性插值得到的目标值。
+// 所有阶段结束后 ok 为 false
+func stageTarget(stages []config.Stage, start float64, elapsed time.Duration) (target float64, ok bool) {
+	from := start
+	for _, stage := range stages {
+		d := stage.Duration.Std()
+		if elapsed < d {
+			progress := float64(elapsed) / float64(d)
+			return from + (stage.Target-from)*progress, true
+		}
+		elapsed -= d
+		from = stage.Target
+	}
+	return from, false
+}
+
+// runStages 在封闭模型下按阶段增减工作协程，直到所有阶段结束或 ctx 被取消。
+// 被回收的协程会先完成当前迭代再退出，work 被取消时中止进行中的请求
+func (r *Runner) runStages(ctx, work context.Context, cfg *config.Config, results chan<- worker.Result, testDataQueue *worker.TestDataQueue, wg *sync.WaitGroup) {
+	log.Printf("开始按 %d 个阶段调整工作协程数...", len(cfg.Stages))
+
+	var stops []chan struct{}
+	startWorker := func(index int) {
+		log.Printf("启动工作协程 #%d", index)
+		stop := make(chan struct{})
+		stops = append(stops, stop)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer r.trackWorker()()
+			w := worker.NewWorker(work, cfg, results, testDataQueue, r.datasets)
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if !w.Iterate() {
+					return
+				}
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(stageTick)
+	defer ticker.Stop()
+	startTime := time.Now()
+loop:
+	for {
+		target, ok := stageTarget(cfg.Stages, float64(cfg.Concurrency), time.Since(startTime))
+		if !ok {
+			break
+		}
+
+		want := int(math.Round(target))
+		for len(stops) < want {
+			startWorker(len(stops))
+		}
+		for len(stops) > want {
+			last := len(stops) - 1
+			close(stops[last])
+			stops = stops[:last]
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			break loop
+		}
+	}
+
+	for _, stop := range stops {
+		close(stop)
+	}
+	log.Println("所有阶段完成，回收工作协程")
+}
@@ -0,0 +1,284 @@
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/bits"
+	"time"
+)
+
+const (
+	// DefaultPrecision 是直方图默认保留的有效数字位数
+	DefaultPrecision = 3
+	// defaultHighestTrackable 是直方图默认可记录的最大值（微秒），超出的值按最大值记录
+	defaultHighestTrackable = int64(time.Hour / time.Microsecond)
+)
+
+// Histogram 是高动态范围（HDR）直方图，以微秒为单位记录时长。
+// 在 [1µs, highestTrackable] 范围内保证 precision 位有效数字，
+// 内存占用只与范围和精度有关，与样本数量无关，可以跨协程、跨运行合并。
+// Histogram 不是线程安全的。
+type Histogram struct {
+	precision        int
+	highestTrackable int64
+
+	subBucketHalfCountMagnitude uint
+	subBucketHalfCount          int64
+	subBucketMask               int64
+	subBucketCount              int64
+
+	counts     []int64
+	totalCount int64
+	min        int64
+	max        int64
+	sum        float64
+}
+
+// NewHistogram 创建一个保留 precision（1-5）位有效数字的直方图
+func NewHistogram(precision int) *Histogram {
+	return newHistogram(defaultHighestTrackable, precision)
+}
+
+func newHistogram(highestTrackable int64, precision int) *Histogram {
+	if precision < 1 || precision > 5 {
+		precision = DefaultPrecision
+	}
+
+	largestValueWithSingleUnitResolution := 2 * int64(math.Pow10(precision))
+	subBucketCountMagnitude := uint(math.Ceil(math.Log2(float64(largestValueWithSingleUnitResolution))))
+	subBucketHalfCountMagnitude := subBucketCountMagnitude - 1
+	subBucketCount := int64(1) << subBucketCountMagnitude
+
+	// 计算覆盖 highestTrackable 需要多少个桶，每个桶的范围是上一个的两倍
+	smallestUntrackableValue := subBucketCount
+	bucketCount := 1
+	for smallestUntrackableValue <= highestTrackable {
+		if smallestUntrackableValue > math.MaxInt64/2 {
+			bucketCount++
+			break
+		}
+		smallestUntrackableValue <<= 1
+		bucketCount++
+	}
+
+	return &Histogram{
+		precision:                   precision,
+		highestTrackable:            highestTrackable,
+		subBucketHalfCountMagnitude: subBucketHalfCountMagnitude,
+		subBucketHalfCount:          subBucketCount / 2,
+		subBucketMask:               subBucketCount - 1,
+		subBucketCount:              subBucketCount,
+		counts:                      make([]int64, (bucketCount+1)*int(subBucketCount/2)),
+		min:                         math.MaxInt64,
+	}
+}
+
+// Record 记录一个时长样本
+func (h *Histogram) Record(d time.Duration) {
+	h.RecordValues(int64(d/time.Microsecond), 1)
+}
+
+// RecordValues 记录 count 个值为 v（微秒）的样本
+func (h *Histogram) RecordValues(v, count int64) {
+	if count <= 0 {
+		return
+	}
+	if v < 0 {
+		v = 0
+	}
+	if v > h.highestTrackable {
+		v = h.highestTrackable
+	}
+
+	h.counts[h.countsIndexFor(v)] += count
+	h.totalCount += count
+	h.sum += float64(v) * float64(count)
+	if v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+}
+
+// Merge 把 other 中的所有样本合并到 h 中
+func (h *Histogram) Merge(other *Histogram) {
+	if other == nil || other.totalCount == 0 {
+		return
+	}
+	if h.precision == other.precision && h.highestTrackable == other.highestTrackable {
+		for i, c := range other.counts {
+			h.counts[i] += c
+		}
+		h.totalCount += other.totalCount
+		h.sum += other.sum
+		if other.min < h.min {
+			h.min = other.min
+		}
+		if other.max > h.max {
+			h.max = other.max
+		}
+		return
+	}
+
+	for i, c := range other.counts {
+		if c > 0 {
+			h.RecordValues(other.valueFromIndex(i), c)
+		}
+	}
+}
+
+// Reset 清空所有样本
+func (h *Histogram) Reset() {
+	for i := range h.counts {
+		h.counts[i] = 0
+	}
+	h.totalCount = 0
+	h.sum = 0
+	h.min = math.MaxInt64
+	h.max = 0
+}
+
+// Count 返回样本总数
+func (h *Histogram) Count() int64 {
+	return h.totalCount
+}
+
+// Min 返回最小样本
+func (h *Histogram) Min() time.Duration {
+	if h.totalCount == 0 {
+		return 0
+	}
+	return time.Duration(h.min) * time.Microsecond
+}
+
+// Max 返回最大样本
+func (h *Histogram) Max() time.Duration {
+	return time.Duration(h.max) * time.Microsecond
+}
+
+// Mean 返回样本平均值
+func (h *Histogram) Mean() time.Duration {
+	if h.totalCount == 0 {
+		return 0
+	}
+	return time.Duration(h.sum / float64(h.totalCount) * float64(time.Microsecond))
+}
+
+// Percentile 返回第 p（0-100）百分位的时长
+func (h *Histogram) Percentile(p float64) time.Duration {
+	if h.totalCount == 0 {
+		return 0
+	}
+	if p > 100 {
+		p = 100
+	}
+
+	countAtPercentile := int64(p/100*float64(h.totalCount) + 0.5)
+	if countAtPercentile < 1 {
+		countAtPercentile = 1
+	}
+
+	var total int64
+	for i, c := range h.counts {
+		total += c
+		if total >= countAtPercentile {
+			v := h.highestEquivalentValue(h.valueFromIndex(i))
+			if v > h.max {
+				v = h.max
+			}
+			return time.Duration(v) * time.Microsecond
+		}
+	}
+	return h.Max()
+}
+
+func (h *Histogram) countsIndexFor(v int64) int {
+	bucketIndex := h.bucketIndex(v)
+	subBucketIndex := h.subBucketIndex(v, bucketIndex)
+	return h.countsIndex(bucketIndex, subBucketIndex)
+}
+
+func (h *Histogram) bucketIndex(v int64) int {
+	pow2Ceiling := 64 - bits.LeadingZeros64(uint64(v|h.subBucketMask))
+	return pow2Ceiling - int(h.subBucketHalfCountMagnitude+1)
+}
+
+func (h *Histogram) subBucketIndex(v int64, bucketIndex int) int64 {
+	return v >> uint(bucketIndex)
+}
+
+func (h *Histogram) countsIndex(bucketIndex int, subBucketIndex int64) int {
+	bucketBaseIndex := (bucketIndex + 1) << h.subBucketHalfCountMagnitude
+	offsetInBucket := int(subBucketIndex - h.subBucketHalfCount)
+	return bucketBaseIndex + offsetInBucket
+}
+
+func (h *Histogram) valueFromIndex(index int) int64 {
+	bucketIndex := (index >> h.subBucketHalfCountMagnitude) - 1
+	subBucketIndex := int64(index&(int(h.subBucketHalfCount)-1)) + h.subBucketHalfCount
+	if bucketIndex < 0 {
+		subBucketIndex -= h.subBucketHalfCount
+		bucketIndex = 0
+	}
+	return subBucketIndex << uint(bucketIndex)
+}
+
+func (h *Histogram) highestEquivalentValue(v int64) int64 {
+	bucketIndex := h.bucketIndex(v)
+	subBucketIndex := h.subBucketIndex(v, bucketIndex)
+	lowest := subBucketIndex << uint(bucketIndex)
+	if subBucketIndex >= h.subBucketCount {
+		bucketIndex++
+	}
+	return lowest + int64(1)<<uint(bucketIndex) - 1
+}
+
+// histogramJSON 是直方图的序列化格式，Counts 为 [值(微秒), 次数] 对，只包含非零项。
+// Counts 中的值是格的下界，Min、Max 和 Sum 保留精确值，使反序列化后的最大值和平均值不变
+type histogramJSON struct {
+	Precision        int        `json:"precision"`
+	HighestTrackable int64      `json:"highestTrackable"`
+	Counts           [][2]int64 `json:"counts"`
+	Min              *int64     `json:"min,omitempty"`
+	Max              *int64     `json:"max,omitempty"`
+	Sum              *float64   `json:"sum,omitempty"`
+}
+
+func (h *Histogram) MarshalJSON() ([]byte, error) {
+	out := histogramJSON{
+		Precision:        h.precision,
+		HighestTrackable: h.highestTrackable,
+		Counts:           [][2]int64{},
+	}
+	if h.totalCount > 0 {
+		out.Min, out.Max, out.Sum = &h.min, &h.max, &h.sum
+	}
+	for i, c := range h.counts {
+		if c > 0 {
+			out.Counts = append(out.Counts, [2]int64{h.valueFromIndex(i), c})
+		}
+	}
+	return json.Marshal(out)
+}
+
+func (h *Histogram) UnmarshalJSON(data []byte) error {
+	var in histogramJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return fmt.Errorf("解析直方图失败: %w", err)
+	}
+	if in.HighestTrackable <= 0 {
+		in.HighestTrackable = defaultHighestTrackable
+	}
+
+	*h = *newHistogram(in.HighestTrackable, in.Precision)
+	for _, pair := range in.Counts {
+		h.RecordValues(pair[0], pair[1])
+	}
+	// 旧版本的报告没有精确值，只能使用格的下界
+	if h.totalCount > 0 && in.Min != nil && in.Max != nil && in.Sum != nil {
+		h.min, h.max, h.sum = *in.Min, *in.Max, *in.Sum
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package stats
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func recordMicros(h *Histogram, values ...int64) {
+	for _, v := range values {
+		h.RecordValues(v, 1)
+	}
+}
+
+func TestHistogramExact(t *testing.T) {
+	h := NewHistogram(3)
+	for v := int64(1); v <= 100; v++ {
+		h.RecordValues(v, 1)
+	}
+	us := time.Microsecond
+	tests := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{0, 1 * us},
+		{1, 1 * us},
+		{50, 50 * us},
+		{90, 90 * us},
+		{99, 99 * us},
+		{99.9, 100 * us},
+		{100, 100 * us},
+		{150, 100 * us},
+	}
+	for _, tt := range tests {
+		if got := h.Percentile(tt.p); got != tt.want {
+			t.Errorf("Percentile(%v) = %v，期望 %v", tt.p, got, tt.want)
+		}
+	}
+	if h.Count() != 100 || h.Min() != us || h.Max() != 100*us || h.Mean() != 50500*time.Nanosecond {
+		t.Errorf("Count/Min/Max/Mean = %d/%v/%v/%v", h.Count(), h.Min(), h.Max(), h.Mean())
+	}
+}
+
+// TestHistogramBucketBoundaries 检查桶边界两侧的值：精度为 3 时 2047µs 以内精确记录，
+// 之后每个桶的分辨率翻倍，同一格内的值报告为该格的最大等价值
+func TestHistogramBucketBoundaries(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []int64
+		p      float64
+		want   int64
+	}{
+		{name: "第一个桶的上界", values: []int64{2047, 9999}, p: 50, want: 2047},
+		{name: "第二个桶的下界", values: []int64{2048, 9999}, p: 50, want: 2049},
+		{name: "第二个桶同一格", values: []int64{2049, 9999}, p: 50, want: 2049},
+		{name: "第二个桶下一格", values: []int64{2050, 9999}, p: 50, want: 2051},
+		{name: "第三个桶分辨率为 4", values: []int64{4096, 4097, 4098, 4099, 9999}, p: 80, want: 4099},
+		// 最大等价值不会超过实际最大值
+		{name: "不超过最大值", values: []int64{2048}, p: 100, want: 2048},
+		{name: "Percentile(100) 是最大值", values: []int64{1, 12345}, p: 100, want: 12345},
+	}
+	for _, tt := range tests {
+		h := NewHistogram(3)
+		recordMicros(h, tt.values...)
+		if got := h.Percentile(tt.p); got != time.Duration(tt.want)*time.Microsecond {
+			t.Errorf("%s: Percentile(%v) = %v，期望 %dµs", tt.name, tt.p, got, tt.want)
+		}
+	}
+}
+
+// TestHistogramPrecision 检查不同有效数字位数下的误差
+func TestHistogramPrecision(t *testing.T) {
+	tests := []struct {
+		precision int
+		value     int64
+		want      int64
+	}{
+		// 精度 1 时 1000µs 落在 [992, 1023] 格内
+		{precision: 1, value: 1000, want: 1023},
+		{precision: 1, value: 31, want: 31},
+		{precision: 3, value: 1000, want: 1000},
+		{precision: 3, value: 123456, want: 123519},
+		{precision: 5, value: 123456, want: 123456},
+		// 超出范围的精度使用默认值
+		{precision: 0, value: 123456, want: 123519},
+		{precision: 6, value: 123456, want: 123519},
+	}
+	for _, tt := range tests {
+		h := NewHistogram(tt.precision)
+		recordMicros(h, tt.value, tt.value*10)
+		if got := h.Percentile(50); got != time.Duration(tt.want)*time.Microsecond {
+			t.Errorf("精度 %d 记录 %dµs: Percentile(50) = %v，期望 %dµs", tt.precision, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestHistogramMerge(t *testing.T) {
+	a := NewHistogram(3)
+	recordMicros(a, 10, 20, 30)
+	b := NewHistogram(3)
+	recordMicros(b, 5, 40)
+	a.Merge(b)
+	a.Merge(nil)
+	a.Merge(NewHistogram(3))
+	if a.Count() != 5 || a.Min() != 5*time.Microsecond || a.Max() != 40*time.Microsecond {
+		t.Errorf("Count/Min/Max = %d/%v/%v", a.Count(), a.Min(), a.Max())
+	}
+	if a.Mean() != 21*time.Microsecond {
+		t.Errorf("Mean = %v，期望 21µs", a.Mean())
+	}
+	if p := a.Percentile(60); p != 20*time.Microsecond {
+		t.Errorf("Percentile(60) = %v，期望 20µs", p)
+	}
+
+	// 精度不同的直方图按格的值重新记录，样本数不变
+	c := NewHistogram(5)
+	recordMicros(c, 100, 200)
+	low := NewHistogram(1)
+	recordMicros(low, 1000)
+	c.Merge(low)
+	if c.Count() != 3 {
+		t.Errorf("合并精度不同的直方图后 Count = %d，期望 3", c.Count())
+	}
+	if p := c.Percentile(100); p != 992*time.Microsecond {
+		t.Errorf("Percentile(100) = %v，期望 992µs（精度 1 的格下界）", p)
+	}
+}
+
+func TestHistogramEmptyAndClamp(t *testing.T) {
+	h := NewHistogram(3)
+	if h.Percentile(50) != 0 || h.Min() != 0 || h.Max() != 0 || h.Mean() != 0 {
+		t.Error("空直方图的统计值应为 0")
+	}
+	h.Record(2 * time.Hour)
+	h.Record(-time.Second)
+	if h.Max() != time.Hour {
+		t.Errorf("超出范围的值应按最大值记录，Max = %v", h.Max())
+	}
+	if h.Min() != 0 {
+		t.Errorf("负值应按 0 记录，Min = %v", h.Min())
+	}
+	h.Reset()
+	if h.Count() != 0 || h.Percentile(99) != 0 {
+		t.Error("Reset 后应没有样本")
+	}
+}
+
+func TestHistogramJSON(t *testing.T) {
+	h := NewHistogram(2)
+	recordMicros(h, 1, 150, 150, 99999)
+	data, err := json.Marshal(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Histogram
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Count() != h.Count() || decoded.Min() != h.Min() || decoded.Max() != h.Max() || decoded.Mean() != h.Mean() {
+		t.Errorf("Count/Min/Max/Mean = %d/%v/%v/%v，期望 %d/%v/%v/%v",
+			decoded.Count(), decoded.Min(), decoded.Max(), decoded.Mean(), h.Count(), h.Min(), h.Max(), h.Mean())
+	}
+	for _, p := range []float64{0, 50, 75, 100} {
+		if got, want := decoded.Percentile(p), h.Percentile(p); got != want {
+			t.Errorf("Percentile(%v) = %v，期望 %v", p, got, want)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package stats
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/tyxben/goloadtest/internal/worker"
+)
+
+// Metrics 是一组请求或工作流迭代的聚合统计，用于按 API 和按事务拆分报告
+type Metrics struct {
+	Count       int
+	Success     int
+	Failed      int
+	Latency     *Histogram
+	StatusCodes map[int]int
+	ErrorTypes  map[string]int
+	// Checks 是按断言名称统计的通过和失败次数
+	Checks map[string]*CheckCount
+}
+
+// CheckCount 是一项断言的通过和失败次数
+type CheckCount struct {
+	Passes int
+	Fails  int
+}
+
+func newMetrics(precision int) *Metrics {
+	return &Metrics{
+		Latency:     NewHistogram(precision),
+		StatusCodes: make(map[int]int),
+		ErrorTypes:  make(map[string]int),
+		Checks:      make(map[string]*CheckCount),
+	}
+}
+
+func (m *Metrics) add(result worker.Result) {
+	m.Count++
+	for _, check := range result.Checks {
+		count, ok := m.Checks[check.Name]
+		if !ok {
+			count = &CheckCount{}
+			m.Checks[check.Name] = count
+		}
+		if check.Passed {
+			count.Passes++
+		} else {
+			count.Fails++
+		}
+	}
+
+	// 断言失败的请求既有状态码又有错误，状态码也要计入
+	if result.StatusCode != 0 {
+		m.StatusCodes[result.StatusCode]++
+	}
+	if result.Error != nil {
+		m.Failed++
+		m.ErrorTypes[fmt.Sprintf("%T", result.Error)]++
+		return
+	}
+	m.Success++
+	m.Latency.Record(result.Duration)
+}
+
+func (m *Metrics) merge(other *Metrics) {
+	m.Count += other.Count
+	m.Success += other.Success
+	m.Failed += other.Failed
+	m.Latency.Merge(other.Latency)
+	for code, count := range other.StatusCodes {
+		m.StatusCodes[code] += count
+	}
+	for errType, count := range other.ErrorTypes {
+		m.ErrorTypes[errType] += count
+	}
+	for name, count := range other.Checks {
+		c, ok := m.Checks[name]
+		if !ok {
+			c = &CheckCount{}
+			m.Checks[name] = c
+		}
+		c.Passes += count.Passes
+		c.Fails += count.Fails
+	}
+}
+
+// sortedKeys 返回 map 的有序键，保证输出顺序稳定
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatStatusCodes(codes map[int]int) string {
+	keys := make([]int, 0, len(codes))
+	for code := range codes {
+		keys = append(keys, code)
+	}
+	sort.Ints(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, code := range keys {
+		parts = append(parts, fmt.Sprintf("%d:%d", code, codes[code]))
+	}
+	return strings.Join(parts, " ")
+}
+
+func formatErrorTypes(errorTypes map[string]int) string {
+	parts := make([]string, 0, len(errorTypes))
+	for _, errType := range sortedKeys(errorTypes) {
+		parts = append(parts, fmt.Sprintf("%s:%d", errType, errorTypes[errType]))
+	}
+	return strings.Join(parts, " ")
+}
+
+// printMetricsTable 以表格形式输出按名称拆分的统计。
+// 表头使用 ASCII 字符，避免中文宽字符导致 tabwriter 对不齐
+func printMetricsTable(out io.Writer, names []string, metrics []*Metrics) {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tTOTAL\tOK\tFAIL\tAVG\tP50\tP90\tP95\tP99\tMAX\tSTATUS\tERRORS")
+	for i, m := range metrics {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%v\t%v\t%v\t%v\t%v\t%v\t%s\t%s\n",
+			names[i], m.Count, m.Success, m.Failed,
+			m.Latency.Mean(), m.Latency.Percentile(50), m.Latency.Percentile(90),
+			m.Latency.Percentile(95), m.Latency.Percentile(99), m.Latency.Max(),
+			formatStatusCodes(m.StatusCodes), formatErrorTypes(m.ErrorTypes))
+	}
+	tw.Flush()
+}
@@ -0,0 +1,81 @@
+package stats
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/tyxben/goloadtest/internal/worker"
+)
+
+// PhaseNames 是请求阶段的名称，按请求中的先后顺序排列
+var PhaseNames = []string{"dns", "connect", "tls", "ttfb", "transfer"}
+
+// Phases 是所有收到响应的请求各阶段耗时的统计，用于区分延迟来自网络、TLS 还是服务端
+type Phases struct {
+	// Latency 的键为 PhaseNames 中的阶段名称。dns、connect 和 tls 只统计新建连接时实际经历的阶段
+	Latency map[string]*Histogram
+	// NewConns 和 ReusedConns 是新建连接和复用连接的请求数
+	NewConns    int
+	ReusedConns int
+}
+
+func newPhases(precision int) *Phases {
+	p := &Phases{Latency: make(map[string]*Histogram, len(PhaseNames))}
+	for _, name := range PhaseNames {
+		p.Latency[name] = NewHistogram(precision)
+	}
+	return p
+}
+
+func (p *Phases) add(t *worker.Timing) {
+	if t.Reused {
+		p.ReusedConns++
+	} else {
+		p.NewConns++
+	}
+	if t.DNS > 0 {
+		p.Latency["dns"].Record(t.DNS)
+	}
+	if t.Connect > 0 {
+		p.Latency["connect"].Record(t.Connect)
+	}
+	if t.TLS > 0 {
+		p.Latency["tls"].Record(t.TLS)
+	}
+	p.Latency["ttfb"].Record(t.TTFB)
+	p.Latency["transfer"].Record(t.Transfer)
+}
+
+func (p *Phases) merge(other *Phases) {
+	p.NewConns += other.NewConns
+	p.ReusedConns += other.ReusedConns
+	for name, h := range other.Latency {
+		p.Latency[name].Merge(h)
+	}
+}
+
+// ReuseRate 返回复用连接的请求占比
+func (p *Phases) ReuseRate() float64 {
+	total := p.NewConns + p.ReusedConns
+	if total == 0 {
+		return 0
+	}
+	return float64(p.ReusedConns) / float64(total)
+}
+
+// printPhasesTable 以表格形式输出各阶段的耗时，没有样本的阶段不输出
+func printPhasesTable(out io.Writer, p *Phases) {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PHASE\tCOUNT\tAVG\tP50\tP90\tP95\tP99\tMAX")
+	for _, name := range PhaseNames {
+		h := p.Latency[name]
+		if h.Count() == 0 {
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%v\t%v\t%v\t%v\t%v\t%v\n",
+			name, h.Count(), h.Mean(), h.Percentile(50), h.Percentile(90),
+			h.Percentile(95), h.Percentile(99), h.Max())
+	}
+	tw.Flush()
+}
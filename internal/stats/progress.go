@@ -0,0 +1,97 @@
+package stats
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/tyxben/goloadtest/internal/worker"
+)
+
+// Progress 在运行期间周期性输出滚动窗口统计：已运行时间、活跃虚拟用户数、
+// 当前 RPS、错误率以及窗口内的 P50/P95/P99。
+// Progress 只应在收集结果的协程中使用，因此不需要加锁，也不会影响工作协程。
+type Progress struct {
+	out        io.Writer
+	start      time.Time
+	windowFrom time.Time
+
+	window         *Histogram
+	windowRequests int
+	windowFailed   int
+
+	total         *Histogram
+	totalRequests int
+	totalFailed   int
+}
+
+// NewProgress 创建一个向 out 输出进度的 Progress，precision 为直方图有效数字位数，
+// 已运行时间从 start 算起
+func NewProgress(out io.Writer, precision int, start time.Time) *Progress {
+	return &Progress{
+		out:        out,
+		start:      start,
+		windowFrom: start,
+		window:     NewHistogram(precision),
+		total:      NewHistogram(precision),
+	}
+}
+
+// Observe 把一个结果计入当前窗口
+func (p *Progress) Observe(result worker.Result) {
+	if result.Iteration {
+		return
+	}
+
+	p.windowRequests++
+	p.totalRequests++
+	if result.Error != nil {
+		p.windowFailed++
+		p.totalFailed++
+		return
+	}
+	p.window.Record(result.Duration)
+	p.total.Record(result.Duration)
+}
+
+// Report 输出当前窗口的统计并开始新的窗口
+func (p *Progress) Report(activeVUs int) {
+	now := time.Now()
+	elapsed := now.Sub(p.start).Truncate(time.Second)
+	windowSeconds := now.Sub(p.windowFrom).Seconds()
+
+	var rps float64
+	if windowSeconds > 0 {
+		rps = float64(p.windowRequests) / windowSeconds
+	}
+
+	fmt.Fprintf(p.out, "[%8v] VUs: %d | RPS: %.1f | 错误率: %.2f%% | P50: %v | P95: %v | P99: %v\n",
+		elapsed, activeVUs, rps, errorRate(p.windowFailed, p.windowRequests),
+		p.window.Percentile(50), p.window.Percentile(95), p.window.Percentile(99))
+
+	p.window.Reset()
+	p.windowRequests = 0
+	p.windowFailed = 0
+	p.windowFrom = now
+}
+
+// Summary 输出整个运行期间的汇总
+func (p *Progress) Summary() {
+	elapsed := time.Since(p.start)
+
+	var rps float64
+	if elapsed > 0 {
+		rps = float64(p.totalRequests) / elapsed.Seconds()
+	}
+
+	fmt.Fprintf(p.out, "[汇总 %v] 请求: %d | RPS: %.1f | 错误率: %.2f%% | P50: %v | P95: %v | P99: %v\n",
+		elapsed.Truncate(time.Millisecond), p.totalRequests, rps, errorRate(p.totalFailed, p.totalRequests),
+		p.total.Percentile(50), p.total.Percentile(95), p.total.Percentile(99))
+}
+
+func errorRate(failed, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(failed) / float64(total) * 100
+}
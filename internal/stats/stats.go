@@ -2,6 +2,7 @@ package stats
 
 import (
 	"fmt"
+	"os"
 	"sort"
 	"time"
 
@@ -20,19 +21,105 @@ type Stats struct {
 	StatusCodes     map[int]int
 	ErrorTypes      map[string]int
 	RequestsPerSec  float64
+	// Elapsed 是整个测试的运行时长
+	Elapsed time.Duration
+	// DroppedIterations 是开放模型下因达到最大并发而未能启动的迭代数
+	DroppedIterations int
+	// LateIterations 是开放模型下实际开始时间明显晚于计划时间的迭代数
+	LateIterations int
+	// Latency 记录所有成功请求的响应时间
+	Latency *Histogram
+	// ChecksPassed 和 ChecksFailed 是所有响应断言的通过和失败次数
+	ChecksPassed int
+	ChecksFailed int
+	// APIs 是按 API 名称拆分的统计
+	APIs map[string]*Metrics
+	// Transactions 是完整工作流迭代（从第一步到最后一步）的统计
+	Transactions *Metrics
+	// Timeline 是按秒聚合的时间序列，由运行器定期调用 Flush
+	Timeline *Timeline
+	// Scenarios 是按场景拆分的统计，只在配置了场景时有数据
+	Scenarios map[string]*ScenarioMetrics
+	// Phases 是请求各阶段（DNS、连接、TLS、首字节、传输）的耗时统计
+	Phases *Phases
+
+	precision         int
+	percentileTargets []float64
+}
+
+// ScenarioMetrics 是一个场景的请求和工作流迭代统计
+type ScenarioMetrics struct {
+	Requests   *Metrics
+	Iterations *Metrics
 }
 
-func NewStats() *Stats {
+// DefaultPercentiles 是未配置 percentiles 时报告的百分位
+var DefaultPercentiles = []float64{50, 75, 90, 95, 99, 99.9, 99.99}
+
+// NewStats 创建统计对象。precision 是延迟直方图的有效数字位数（1-5，0 表示默认值），
+// percentiles 是需要报告的百分位，为空时使用 DefaultPercentiles
+func NewStats(precision int, percentiles []float64) *Stats {
+	if len(percentiles) == 0 {
+		percentiles = DefaultPercentiles
+	}
 	return &Stats{
-		MinDuration: time.Duration(1<<63 - 1),
-		Percentiles: make(map[float64]time.Duration),
-		StatusCodes: make(map[int]int),
-		ErrorTypes:  make(map[string]int),
+		MinDuration:       time.Duration(1<<63 - 1),
+		Percentiles:       make(map[float64]time.Duration),
+		StatusCodes:       make(map[int]int),
+		ErrorTypes:        make(map[string]int),
+		Latency:           NewHistogram(precision),
+		APIs:              make(map[string]*Metrics),
+		Transactions:      newMetrics(precision),
+		Timeline:          NewTimeline(precision),
+		Scenarios:         make(map[string]*ScenarioMetrics),
+		Phases:            newPhases(precision),
+		precision:         precision,
+		percentileTargets: percentiles,
 	}
 }
 
+// Start 标记负载阶段开始，时间序列从 at 开始计时
+func (s *Stats) Start(at time.Time) {
+	s.Timeline.Start(at)
+}
+
 func (s *Stats) AddResult(result worker.Result) {
+	s.Timeline.Observe(result)
+	if result.Scenario != "" {
+		scenario := s.scenario(result.Scenario)
+		if result.Iteration {
+			scenario.Iterations.add(result)
+		} else {
+			scenario.Requests.add(result)
+		}
+	}
+	if result.Iteration {
+		s.Transactions.add(result)
+		return
+	}
+
+	api, ok := s.APIs[result.APIName]
+	if !ok {
+		api = newMetrics(s.precision)
+		s.APIs[result.APIName] = api
+	}
+	api.add(result)
+	if result.Timing != nil {
+		s.Phases.add(result.Timing)
+	}
+
+	for _, check := range result.Checks {
+		if check.Passed {
+			s.ChecksPassed++
+		} else {
+			s.ChecksFailed++
+		}
+	}
+
 	s.TotalRequests++
+	if result.StatusCode != 0 {
+		s.StatusCodes[result.StatusCode]++
+	}
 	if result.Error != nil {
 		s.FailedRequests++
 		errorType := fmt.Sprintf("%T", result.Error)
@@ -40,7 +127,7 @@ func (s *Stats) AddResult(result worker.Result) {
 	} else {
 		s.SuccessRequests++
 		s.TotalDuration += result.Duration
-		s.StatusCodes[result.StatusCode]++
+		s.Latency.Record(result.Duration)
 
 		if result.Duration < s.MinDuration {
 			s.MinDuration = result.Duration
@@ -51,26 +138,76 @@ func (s *Stats) AddResult(result worker.Result) {
 	}
 }
 
+func (s *Stats) scenario(name string) *ScenarioMetrics {
+	scenario, ok := s.Scenarios[name]
+	if !ok {
+		scenario = &ScenarioMetrics{
+			Requests:   newMetrics(s.precision),
+			Iterations: newMetrics(s.precision),
+		}
+		s.Scenarios[name] = scenario
+	}
+	return scenario
+}
+
 func (s *Stats) CalculateStats(duration time.Duration) {
 	if s.SuccessRequests > 0 {
 		s.AvgDuration = s.TotalDuration / time.Duration(s.SuccessRequests)
 	}
+	s.Elapsed = duration
 	s.RequestsPerSec = float64(s.TotalRequests) / duration.Seconds()
 
 	// 计算百分位数
-	var durations []time.Duration
-	for code, count := range s.StatusCodes {
-		for i := 0; i < count; i++ {
-			durations = append(durations, time.Duration(code))
-		}
+	for _, p := range s.percentileTargets {
+		s.Percentiles[p] = s.Latency.Percentile(p)
 	}
-	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
-	percentiles := []float64{50, 75, 90, 95, 99}
-	for _, p := range percentiles {
-		index := int(float64(len(durations)) * p / 100)
-		if index > 0 && index < len(durations) {
-			s.Percentiles[p] = durations[index]
+}
+
+// PercentileTargets 返回需要报告的百分位
+func (s *Stats) PercentileTargets() []float64 {
+	return s.percentileTargets
+}
+
+// Merge 把另一个统计对象（例如另一个协程或另一次运行的结果）合并到 s 中，
+// 合并后需要重新调用 CalculateStats。
+// Timeline 不合并：数据点只保留每个窗口算好的百分位，无法还原为直方图重新计算，
+// 不同运行的时间轴也不对齐，合并后 s 的 Timeline 保持不变
+func (s *Stats) Merge(other *Stats) {
+	s.TotalRequests += other.TotalRequests
+	s.SuccessRequests += other.SuccessRequests
+	s.FailedRequests += other.FailedRequests
+	s.TotalDuration += other.TotalDuration
+	s.DroppedIterations += other.DroppedIterations
+	s.LateIterations += other.LateIterations
+	s.ChecksPassed += other.ChecksPassed
+	s.ChecksFailed += other.ChecksFailed
+	if other.MinDuration < s.MinDuration {
+		s.MinDuration = other.MinDuration
+	}
+	if other.MaxDuration > s.MaxDuration {
+		s.MaxDuration = other.MaxDuration
+	}
+	for code, count := range other.StatusCodes {
+		s.StatusCodes[code] += count
+	}
+	for errType, count := range other.ErrorTypes {
+		s.ErrorTypes[errType] += count
+	}
+	s.Latency.Merge(other.Latency)
+	for name, m := range other.APIs {
+		api, ok := s.APIs[name]
+		if !ok {
+			api = newMetrics(s.precision)
+			s.APIs[name] = api
 		}
+		api.merge(m)
+	}
+	s.Transactions.merge(other.Transactions)
+	s.Phases.merge(other.Phases)
+	for name, m := range other.Scenarios {
+		scenario := s.scenario(name)
+		scenario.Requests.merge(m.Requests)
+		scenario.Iterations.merge(m.Iterations)
 	}
 }
 
@@ -85,19 +222,85 @@ func (s *Stats) Print() {
 	fmt.Printf("最小响应时间: %v\n", s.MinDuration)
 	fmt.Printf("最大响应时间: %v\n", s.MaxDuration)
 	fmt.Printf("平均响应时间: %v\n", s.AvgDuration)
+	if s.DroppedIterations > 0 {
+		fmt.Printf("丢弃迭代数: %d\n", s.DroppedIterations)
+	}
+	if s.LateIterations > 0 {
+		fmt.Printf("延迟启动迭代数: %d\n", s.LateIterations)
+	}
 
 	fmt.Printf("\n响应时间分布:\n")
-	for p, d := range s.Percentiles {
-		fmt.Printf("%v%%分位数: %v\n", p, d)
+	percentiles := make([]float64, 0, len(s.Percentiles))
+	for p := range s.Percentiles {
+		percentiles = append(percentiles, p)
+	}
+	sort.Float64s(percentiles)
+	for _, p := range percentiles {
+		fmt.Printf("%v%%分位数: %v\n", p, s.Percentiles[p])
 	}
 
 	fmt.Printf("\n状态码分布:\n")
-	for code, count := range s.StatusCodes {
-		fmt.Printf("状态码 %d: %d次\n", code, count)
+	codes := make([]int, 0, len(s.StatusCodes))
+	for code := range s.StatusCodes {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fmt.Printf("状态码 %d: %d次\n", code, s.StatusCodes[code])
 	}
 
 	fmt.Printf("\n错误类型分布:\n")
-	for errType, count := range s.ErrorTypes {
-		fmt.Printf("%s: %d次\n", errType, count)
+	for _, errType := range sortedKeys(s.ErrorTypes) {
+		fmt.Printf("%s: %d次\n", errType, s.ErrorTypes[errType])
+	}
+
+	if total := s.Phases.NewConns + s.Phases.ReusedConns; total > 0 {
+		fmt.Printf("\n请求阶段耗时（新建连接 %d，复用连接 %d，复用率 %.2f%%）:\n",
+			s.Phases.NewConns, s.Phases.ReusedConns, s.Phases.ReuseRate()*100)
+		printPhasesTable(os.Stdout, s.Phases)
+	}
+
+	if len(s.APIs) > 0 {
+		fmt.Printf("\n按 API 统计:\n")
+		names := sortedKeys(s.APIs)
+		metrics := make([]*Metrics, len(names))
+		for i, name := range names {
+			metrics[i] = s.APIs[name]
+		}
+		printMetricsTable(os.Stdout, names, metrics)
+	}
+
+	if s.ChecksPassed+s.ChecksFailed > 0 {
+		fmt.Printf("\n断言统计（通过 %d，失败 %d）:\n", s.ChecksPassed, s.ChecksFailed)
+		for _, name := range sortedKeys(s.APIs) {
+			api := s.APIs[name]
+			for _, check := range sortedKeys(api.Checks) {
+				count := api.Checks[check]
+				mark := "✓"
+				if count.Fails > 0 {
+					mark = "✗"
+				}
+				fmt.Printf("%s %s: %s  通过 %d，失败 %d\n", mark, name, check, count.Passes, count.Fails)
+			}
+		}
+	}
+
+	if s.Transactions.Count > 0 {
+		fmt.Printf("\n工作流事务统计:\n")
+		printMetricsTable(os.Stdout, []string{"workflow"}, []*Metrics{s.Transactions})
+	}
+
+	if len(s.Scenarios) > 0 {
+		names := sortedKeys(s.Scenarios)
+		requests := make([]*Metrics, len(names))
+		iterations := make([]*Metrics, len(names))
+		for i, name := range names {
+			requests[i] = s.Scenarios[name].Requests
+			iterations[i] = s.Scenarios[name].Iterations
+		}
+		fmt.Printf("\n按场景统计（请求）:\n")
+		printMetricsTable(os.Stdout, names, requests)
+		fmt.Printf("\n按场景统计（工作流迭代）:\n")
+		printMetricsTable(os.Stdout, names, iterations)
 	}
 }
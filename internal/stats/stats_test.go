@@ -0,0 +1,62 @@
+package stats
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tyxben/goloadtest/internal/worker"
+)
+
+func TestStatsMerge(t *testing.T) {
+	a := NewStats(0, nil)
+	a.AddResult(worker.Result{APIName: "login", StatusCode: 200, Duration: 10 * time.Millisecond})
+	a.AddResult(worker.Result{APIName: "login", Duration: time.Millisecond, Error: errors.New("boom")})
+	a.DroppedIterations = 1
+	a.Timeline.Flush(1)
+	points := len(a.Timeline.Points)
+
+	b := NewStats(0, nil)
+	b.AddResult(worker.Result{APIName: "login", StatusCode: 200, Duration: 30 * time.Millisecond})
+	b.AddResult(worker.Result{APIName: "search", Scenario: "buy", StatusCode: 201, Duration: 5 * time.Millisecond,
+		Checks: []worker.CheckResult{{Name: "ok", Passed: true}}})
+	b.AddResult(worker.Result{Scenario: "buy", Duration: 50 * time.Millisecond, Iteration: true})
+	b.DroppedIterations = 2
+	b.LateIterations = 3
+	b.Timeline.Flush(1)
+
+	a.Merge(b)
+	a.CalculateStats(time.Second)
+
+	if a.TotalRequests != 4 || a.SuccessRequests != 3 || a.FailedRequests != 1 {
+		t.Errorf("Total/Success/Failed = %d/%d/%d，期望 4/3/1", a.TotalRequests, a.SuccessRequests, a.FailedRequests)
+	}
+	if a.MinDuration != 5*time.Millisecond || a.MaxDuration != 30*time.Millisecond {
+		t.Errorf("Min/Max = %v/%v", a.MinDuration, a.MaxDuration)
+	}
+	if a.Latency.Count() != 3 || a.Latency.Max() != 30*time.Millisecond {
+		t.Errorf("Latency Count/Max = %d/%v", a.Latency.Count(), a.Latency.Max())
+	}
+	if a.StatusCodes[200] != 2 || a.StatusCodes[201] != 1 || a.ErrorTypes["*errors.errorString"] != 1 {
+		t.Errorf("StatusCodes = %v，ErrorTypes = %v", a.StatusCodes, a.ErrorTypes)
+	}
+	if a.DroppedIterations != 3 || a.LateIterations != 3 || a.ChecksPassed != 1 {
+		t.Errorf("Dropped/Late/ChecksPassed = %d/%d/%d", a.DroppedIterations, a.LateIterations, a.ChecksPassed)
+	}
+	if login := a.APIs["login"]; login == nil || login.Count != 3 || login.Failed != 1 {
+		t.Errorf("login = %+v", login)
+	}
+	if search := a.APIs["search"]; search == nil || search.Count != 1 || search.Checks["ok"].Passes != 1 {
+		t.Errorf("search = %+v", search)
+	}
+	if a.Transactions.Count != 1 {
+		t.Errorf("Transactions.Count = %d，期望 1", a.Transactions.Count)
+	}
+	if buy := a.Scenarios["buy"]; buy == nil || buy.Requests.Count != 1 || buy.Iterations.Count != 1 {
+		t.Errorf("场景 buy = %+v", buy)
+	}
+	// 时间序列不合并
+	if len(a.Timeline.Points) != points {
+		t.Errorf("Timeline 有 %d 个数据点，期望保持 %d 个", len(a.Timeline.Points), points)
+	}
+}
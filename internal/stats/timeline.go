@@ -0,0 +1,98 @@
+package stats
+
+import (
+	"time"
+
+	"github.com/tyxben/goloadtest/internal/worker"
+)
+
+// TimelineInterval 是时间序列每个数据点覆盖的时长
+const TimelineInterval = time.Second
+
+// TimelinePoint 是时间序列中的一个数据点
+type TimelinePoint struct {
+	// Offset 是数据点结束时距测试开始的时长
+	Offset    time.Duration
+	Requests  int
+	Failed    int
+	RPS       float64
+	ErrorRate float64
+	P50       time.Duration
+	P90       time.Duration
+	P95       time.Duration
+	P99       time.Duration
+	ActiveVUs int
+}
+
+// Timeline 把结果流按时间窗口聚合成时间序列，每个窗口只保留计算好的指标，
+// 内存占用与运行时长成正比、与请求数无关。Timeline 不是线程安全的
+type Timeline struct {
+	Points []TimelinePoint
+
+	start      time.Time
+	windowFrom time.Time
+	window     *Histogram
+	requests   int
+	failed     int
+}
+
+// NewTimeline 创建时间序列，precision 为窗口直方图的有效数字位数
+func NewTimeline(precision int) *Timeline {
+	now := time.Now()
+	return &Timeline{
+		start:      now,
+		windowFrom: now,
+		window:     NewHistogram(precision),
+	}
+}
+
+// Start 把测试开始时间设为 at，之后数据点的 Offset 从 at 算起。
+// 运行器在 setup 结束、负载开始时调用，setup 的耗时不计入时间序列
+func (t *Timeline) Start(at time.Time) {
+	t.start = at
+	t.windowFrom = at
+}
+
+// Observe 把一个请求结果计入当前窗口
+func (t *Timeline) Observe(result worker.Result) {
+	if result.Iteration {
+		return
+	}
+
+	t.requests++
+	if result.Error != nil {
+		t.failed++
+		return
+	}
+	t.window.Record(result.Duration)
+}
+
+// Flush 结束当前窗口并追加一个数据点，activeVUs 是此刻的活跃虚拟用户数
+func (t *Timeline) Flush(activeVUs int) {
+	now := time.Now()
+	seconds := now.Sub(t.windowFrom).Seconds()
+	if seconds <= 0 {
+		return
+	}
+
+	point := TimelinePoint{
+		Offset:    now.Sub(t.start),
+		Requests:  t.requests,
+		Failed:    t.failed,
+		RPS:       float64(t.requests) / seconds,
+		P50:       t.window.Percentile(50),
+		P90:       t.window.Percentile(90),
+		P95:       t.window.Percentile(95),
+		P99:       t.window.Percentile(99),
+		ActiveVUs: activeVUs,
+	}
+	if t.requests > 0 {
+		point.ErrorRate = float64(t.failed) / float64(t.requests)
+	}
+	t.Points = append(t.Points, point)
+
+	t.window.Reset()
+	t.requests = 0
+	t.failed = 0
+	t.windowFrom = now
+}
@@ -0,0 +1,381 @@
+package template
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	mathrand "math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Func 是模板函数。管道传入的值作为最后一个参数
+type Func func(args ...interface{}) (interface{}, error)
+
+var funcs = map[string]Func{
+	"uuid":         uuidFunc,
+	"randInt":      randIntFunc,
+	"randString":   randStringFunc,
+	"now":          nowFunc,
+	"base64":       base64Func,
+	"base64Decode": base64DecodeFunc,
+	"sha256":       sha256Func,
+	"md5":          md5Func,
+	"jsonEscape":   jsonEscapeFunc,
+	"json":         jsonFunc,
+	"upper":        stringFunc(strings.ToUpper),
+	"lower":        stringFunc(strings.ToLower),
+	"string":       stringFunc(func(s string) string { return s }),
+	"int":          intFunc,
+	"exists":       existsFunc,
+	"default":      defaultFunc,
+	"len":          lenFunc,
+	"eq":           compareFunc(func(c int) bool { return c == 0 }),
+	"ne":           compareFunc(func(c int) bool { return c != 0 }),
+	"lt":           compareFunc(func(c int) bool { return c < 0 }),
+	"le":           compareFunc(func(c int) bool { return c <= 0 }),
+	"gt":           compareFunc(func(c int) bool { return c > 0 }),
+	"ge":           compareFunc(func(c int) bool { return c >= 0 }),
+	"and":          andFunc,
+	"or":           orFunc,
+	"not":          notFunc,
+	"contains":     containsFunc,
+}
+
+// lenientFuncs 中的函数可以接收不存在的变量作为参数
+var lenientFuncs = map[string]bool{
+	"exists":  true,
+	"default": true,
+	"and":     true,
+	"or":      true,
+	"not":     true,
+}
+
+// RegisterFunc 注册一个模板函数，应在 init 中调用
+func RegisterFunc(name string, fn Func) {
+	funcs[name] = fn
+}
+
+func lookupFunc(name string) (Func, bool) {
+	fn, ok := funcs[name]
+	return fn, ok
+}
+
+func checkArgs(args []interface{}, min, max int) error {
+	if len(args) < min || len(args) > max {
+		if min == max {
+			return fmt.Errorf("需要 %d 个参数，实际 %d 个", min, len(args))
+		}
+		return fmt.Errorf("需要 %d-%d 个参数，实际 %d 个", min, max, len(args))
+	}
+	return nil
+}
+
+// ToInt 把表达式结果转换为整数
+func ToInt(v interface{}) (int64, error) {
+	switch value := v.(type) {
+	case int:
+		return int64(value), nil
+	case int64:
+		return value, nil
+	case float64:
+		return int64(value), nil
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return i, nil
+		}
+		f, err := value.Float64()
+		return int64(f), err
+	case string:
+		return strconv.ParseInt(value, 10, 64)
+	default:
+		return 0, fmt.Errorf("无法把 %v 转换为整数", v)
+	}
+}
+
+func stringFunc(fn func(string) string) Func {
+	return func(args ...interface{}) (interface{}, error) {
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		return fn(ToString(args[0])), nil
+	}
+}
+
+// uuidFunc 生成随机的 UUID v4
+func uuidFunc(args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 0, 0); err != nil {
+		return nil, err
+	}
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return nil, err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+// randIntFunc 返回 [min, max] 之间的随机整数
+func randIntFunc(args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 2, 2); err != nil {
+		return nil, err
+	}
+	min, err := ToInt(args[0])
+	if err != nil {
+		return nil, err
+	}
+	max, err := ToInt(args[1])
+	if err != nil {
+		return nil, err
+	}
+	if max < min {
+		return nil, fmt.Errorf("最大值 %d 小于最小值 %d", max, min)
+	}
+	return min + mathrand.Int63n(max-min+1), nil
+}
+
+const randStringLetters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// randStringFunc 返回指定长度的随机字母数字字符串
+func randStringFunc(args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return nil, err
+	}
+	n, err := ToInt(args[0])
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = randStringLetters[mathrand.Intn(len(randStringLetters))]
+	}
+	return string(b), nil
+}
+
+// nowFunc 返回当前时间。参数可以是 unix、unixMilli、unixNano、rfc3339 或 Go 时间格式，默认 RFC3339
+func nowFunc(args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 0, 1); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	layout := time.RFC3339
+	if len(args) == 1 {
+		layout = ToString(args[0])
+	}
+	switch layout {
+	case "unix":
+		return now.Unix(), nil
+	case "unixMilli":
+		return now.UnixMilli(), nil
+	case "unixNano":
+		return now.UnixNano(), nil
+	case "rfc3339":
+		return now.UTC().Format(time.RFC3339), nil
+	default:
+		return now.Format(layout), nil
+	}
+}
+
+func base64Func(args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.EncodeToString([]byte(ToString(args[0]))), nil
+}
+
+func base64DecodeFunc(args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(ToString(args[0]))
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// sha256Func 返回参数的 SHA-256 十六进制摘要
+func sha256Func(args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(ToString(args[0])))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// md5Func 返回参数的 MD5 十六进制摘要
+func md5Func(args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return nil, err
+	}
+	sum := md5.Sum([]byte(ToString(args[0])))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// jsonEscapeFunc 转义字符串，使其可以直接放在 JSON 字符串的引号内
+func jsonEscapeFunc(args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(ToString(args[0]))
+	if err != nil {
+		return nil, err
+	}
+	return string(data[1 : len(data)-1]), nil
+}
+
+// jsonFunc 把参数编码为 JSON 字符串
+func jsonFunc(args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func intFunc(args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return nil, err
+	}
+	return ToInt(args[0])
+}
+
+// existsFunc 返回变量是否存在
+func existsFunc(args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return nil, err
+	}
+	_, missing := args[0].(missingValue)
+	return !missing, nil
+}
+
+// defaultFunc 在变量不存在或为空字符串时返回默认值：{{default "guest" name}} 或 {{name | default "guest"}}
+func defaultFunc(args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 2, 2); err != nil {
+		return nil, err
+	}
+	v := args[1]
+	if _, missing := v.(missingValue); missing || v == nil || v == "" {
+		return args[0], nil
+	}
+	return v, nil
+}
+
+// toFloat 把数字或数字字符串转换为 float64
+func toFloat(v interface{}) (float64, bool) {
+	switch value := v.(type) {
+	case int:
+		return float64(value), true
+	case int64:
+		return float64(value), true
+	case float64:
+		return value, true
+	case json.Number:
+		f, err := value.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(value, 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// compare 比较两个值：都能转换为数字时按数字比较，否则按字符串比较
+func compare(a, b interface{}) int {
+	fa, okA := toFloat(a)
+	fb, okB := toFloat(b)
+	if okA && okB {
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		default:
+			return 0
+		}
+	}
+	return strings.Compare(ToString(a), ToString(b))
+}
+
+func compareFunc(fn func(int) bool) Func {
+	return func(args ...interface{}) (interface{}, error) {
+		if err := checkArgs(args, 2, 2); err != nil {
+			return nil, err
+		}
+		return fn(compare(args[0], args[1])), nil
+	}
+}
+
+// andFunc 在所有参数都为真时返回真，不存在的变量视为假
+func andFunc(args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 2, len(args)); err != nil {
+		return nil, err
+	}
+	for _, arg := range args {
+		if !Truthy(arg) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// orFunc 在任一参数为真时返回真，不存在的变量视为假
+func orFunc(args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 2, len(args)); err != nil {
+		return nil, err
+	}
+	for _, arg := range args {
+		if Truthy(arg) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func notFunc(args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return nil, err
+	}
+	return !Truthy(args[0]), nil
+}
+
+// lenFunc 返回字符串、数组或对象的长度
+func lenFunc(args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return nil, err
+	}
+	switch value := args[0].(type) {
+	case []interface{}:
+		return int64(len(value)), nil
+	case map[string]interface{}:
+		return int64(len(value)), nil
+	default:
+		return int64(len(ToString(value))), nil
+	}
+}
+
+// containsFunc 返回字符串是否包含子串，或数组是否包含元素：{{contains "ok" msg}}
+func containsFunc(args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 2, 2); err != nil {
+		return nil, err
+	}
+	if items, ok := args[1].([]interface{}); ok {
+		for _, item := range items {
+			if compare(item, args[0]) == 0 {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return strings.Contains(ToString(args[1]), ToString(args[0])), nil
+}
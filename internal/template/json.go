@@ -0,0 +1,176 @@
+package template
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// JSONTemplate 是编译后的 JSON 模板。对象的键和所有字符串值都可以包含表达式，
+// 只含一个表达式的字符串值保留表达式结果的类型
+type JSONTemplate struct {
+	root jsonNode
+}
+
+type jsonNode interface {
+	render(vars map[string]interface{}) (interface{}, error)
+	collectVars(set map[string]bool)
+}
+
+type jsonLiteral struct {
+	value interface{}
+}
+
+type jsonString struct {
+	tmpl *Template
+}
+
+type jsonMember struct {
+	key   *Template
+	value jsonNode
+}
+
+type jsonObject struct {
+	members []jsonMember
+}
+
+type jsonArray struct {
+	items []jsonNode
+}
+
+// CompileJSON 编译 JSON 模板
+func CompileJSON(raw []byte) (*JSONTemplate, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("解析 JSON 模板失败: %w", err)
+	}
+	root, err := compileJSONValue(doc)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONTemplate{root: root}, nil
+}
+
+func compileJSONValue(v interface{}) (jsonNode, error) {
+	switch value := v.(type) {
+	case string:
+		tmpl, err := Compile(value)
+		if err != nil {
+			return nil, err
+		}
+		if tmpl.IsStatic() {
+			return jsonLiteral{value: value}, nil
+		}
+		return jsonString{tmpl: tmpl}, nil
+
+	case map[string]interface{}:
+		obj := &jsonObject{}
+		for key, item := range value {
+			keyTmpl, err := Compile(key)
+			if err != nil {
+				return nil, err
+			}
+			node, err := compileJSONValue(item)
+			if err != nil {
+				return nil, err
+			}
+			obj.members = append(obj.members, jsonMember{key: keyTmpl, value: node})
+		}
+		return obj, nil
+
+	case []interface{}:
+		arr := &jsonArray{}
+		for _, item := range value {
+			node, err := compileJSONValue(item)
+			if err != nil {
+				return nil, err
+			}
+			arr.items = append(arr.items, node)
+		}
+		return arr, nil
+
+	default:
+		return jsonLiteral{value: value}, nil
+	}
+}
+
+// Render 渲染模板并编码为 JSON。对象成员的值引用了不存在的变量时省略该成员，
+// 数组元素引用了不存在的变量时为 null
+func (t *JSONTemplate) Render(vars map[string]interface{}) ([]byte, error) {
+	v, err := t.root.render(vars)
+	if err != nil {
+		if !IsMissing(err) {
+			return nil, err
+		}
+		v = nil
+	}
+	return json.Marshal(v)
+}
+
+// Vars 返回模板引用的变量名，规则同 Template.Vars
+func (t *JSONTemplate) Vars() []string {
+	set := make(map[string]bool)
+	t.root.collectVars(set)
+	return setToSlice(set)
+}
+
+func (n jsonLiteral) render(map[string]interface{}) (interface{}, error) {
+	return n.value, nil
+}
+
+func (n jsonString) render(vars map[string]interface{}) (interface{}, error) {
+	return n.tmpl.Execute(vars)
+}
+
+func (n *jsonObject) render(vars map[string]interface{}) (interface{}, error) {
+	result := make(map[string]interface{}, len(n.members))
+	for _, m := range n.members {
+		key, err := m.key.Render(vars)
+		if err != nil {
+			return nil, err
+		}
+		value, err := m.value.render(vars)
+		if err != nil {
+			if IsMissing(err) {
+				continue
+			}
+			return nil, err
+		}
+		result[key] = value
+	}
+	return result, nil
+}
+
+func (n *jsonArray) render(vars map[string]interface{}) (interface{}, error) {
+	result := make([]interface{}, len(n.items))
+	for i, item := range n.items {
+		value, err := item.render(vars)
+		if err != nil && !IsMissing(err) {
+			return nil, err
+		}
+		result[i] = value
+	}
+	return result, nil
+}
+
+func (n jsonLiteral) collectVars(map[string]bool) {}
+
+func (n jsonString) collectVars(set map[string]bool) {
+	n.tmpl.collectVars(set)
+}
+
+func (n *jsonObject) collectVars(set map[string]bool) {
+	for _, m := range n.members {
+		m.key.collectVars(set)
+		m.value.collectVars(set)
+	}
+}
+
+func (n *jsonArray) collectVars(set map[string]bool) {
+	for _, item := range n.items {
+		item.collectVars(set)
+	}
+}
@@ -0,0 +1,334 @@
+package template
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// pipeline 是用 | 连接的一组命令，前一个命令的结果作为后一个命令的最后一个参数
+type pipeline struct {
+	commands []*command
+}
+
+// command 是一个函数调用或单个值
+type command struct {
+	terms []*term
+}
+
+type termKind int
+
+const (
+	termIdent termKind = iota
+	termLiteral
+	termPipeline
+)
+
+type term struct {
+	kind  termKind
+	ident string
+	// variable 为 true 表示标识符以 . 开头，总是按变量查找而不是函数
+	variable bool
+	literal  interface{}
+	sub      *pipeline
+}
+
+type tokenKind int
+
+const (
+	tokenIdent tokenKind = iota
+	tokenString
+	tokenNumber
+	tokenPipe
+	tokenLeftParen
+	tokenRightParen
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+}
+
+func parseExpression(expr string) (*pipeline, error) {
+	tokens, err := lex(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("空表达式")
+	}
+
+	p := &parser{tokens: tokens}
+	pipe, err := p.parsePipeline()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("表达式 %q 中有多余的 %q", expr, p.tokens[p.pos].value)
+	}
+	return pipe, nil
+}
+
+func lex(expr string) ([]token, error) {
+	var tokens []token
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '|':
+			tokens = append(tokens, token{kind: tokenPipe, value: "|"})
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenLeftParen, value: "("})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenRightParen, value: ")"})
+			i++
+		case r == '"':
+			j := i + 1
+			for ; j < len(runes) && runes[j] != '"'; j++ {
+				if runes[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("表达式 %q 中的字符串没有结束", expr)
+			}
+			s, err := strconv.Unquote(string(runes[i : j+1]))
+			if err != nil {
+				return nil, fmt.Errorf("表达式 %q 中的字符串无效: %w", expr, err)
+			}
+			tokens = append(tokens, token{kind: tokenString, value: s})
+			i = j + 1
+		case r == '\'':
+			j := i + 1
+			for ; j < len(runes) && runes[j] != '\''; j++ {
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("表达式 %q 中的字符串没有结束", expr)
+			}
+			tokens = append(tokens, token{kind: tokenString, value: string(runes[i+1 : j])})
+			i = j + 1
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			j := i + 1
+			for ; j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.'); j++ {
+			}
+			tokens = append(tokens, token{kind: tokenNumber, value: string(runes[i:j])})
+			i = j
+		case isIdentRune(r) || r == '.':
+			j := i + 1
+			for ; j < len(runes) && (isIdentRune(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '.' || runes[j] == '-'); j++ {
+			}
+			tokens = append(tokens, token{kind: tokenIdent, value: string(runes[i:j])})
+			i = j
+		default:
+			return nil, fmt.Errorf("表达式 %q 中有无效字符 %q", expr, r)
+		}
+	}
+	return tokens, nil
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) parsePipeline() (*pipeline, error) {
+	pipe := &pipeline{}
+	for {
+		cmd, err := p.parseCommand()
+		if err != nil {
+			return nil, err
+		}
+		pipe.commands = append(pipe.commands, cmd)
+
+		if p.pos < len(p.tokens) && p.tokens[p.pos].kind == tokenPipe {
+			p.pos++
+			continue
+		}
+		return pipe, nil
+	}
+}
+
+func (p *parser) parseCommand() (*command, error) {
+	cmd := &command{}
+	for p.pos < len(p.tokens) {
+		tok := p.tokens[p.pos]
+		switch tok.kind {
+		case tokenPipe, tokenRightParen:
+			if len(cmd.terms) == 0 {
+				return nil, fmt.Errorf("%q 前缺少表达式", tok.value)
+			}
+			return cmd, nil
+		case tokenLeftParen:
+			p.pos++
+			sub, err := p.parsePipeline()
+			if err != nil {
+				return nil, err
+			}
+			if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != tokenRightParen {
+				return nil, fmt.Errorf("缺少 )")
+			}
+			p.pos++
+			cmd.terms = append(cmd.terms, &term{kind: termPipeline, sub: sub})
+		case tokenString:
+			p.pos++
+			cmd.terms = append(cmd.terms, &term{kind: termLiteral, literal: tok.value})
+		case tokenNumber:
+			p.pos++
+			n, err := parseNumber(tok.value)
+			if err != nil {
+				return nil, err
+			}
+			cmd.terms = append(cmd.terms, &term{kind: termLiteral, literal: n})
+		case tokenIdent:
+			p.pos++
+			switch tok.value {
+			case "true":
+				cmd.terms = append(cmd.terms, &term{kind: termLiteral, literal: true})
+			case "false":
+				cmd.terms = append(cmd.terms, &term{kind: termLiteral, literal: false})
+			case "null", "nil":
+				cmd.terms = append(cmd.terms, &term{kind: termLiteral, literal: nil})
+			default:
+				name := strings.TrimPrefix(tok.value, ".")
+				if name == "" {
+					return nil, fmt.Errorf("无效的变量名 %q", tok.value)
+				}
+				cmd.terms = append(cmd.terms, &term{kind: termIdent, ident: name, variable: name != tok.value})
+			}
+		}
+	}
+	if len(cmd.terms) == 0 {
+		return nil, fmt.Errorf("缺少表达式")
+	}
+	return cmd, nil
+}
+
+func parseNumber(s string) (interface{}, error) {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, fmt.Errorf("无效的数字 %q", s)
+	}
+	return f, nil
+}
+
+// missingValue 是传给宽松函数（如 exists、default）的不存在变量的占位值
+type missingValue struct {
+	name string
+}
+
+func (p *pipeline) eval(vars map[string]interface{}) (interface{}, error) {
+	var piped interface{}
+	hasPiped := false
+	for _, cmd := range p.commands {
+		v, err := cmd.eval(vars, piped, hasPiped)
+		if err != nil {
+			return nil, err
+		}
+		if m, ok := v.(missingValue); ok {
+			return nil, &MissingError{Name: m.name}
+		}
+		piped, hasPiped = v, true
+	}
+	return piped, nil
+}
+
+// eval 对命令求值。只有一个标识符且没有管道输入时与括号内的参数一样先查找变量，
+// 变量不存在时才调用同名的无参函数，这样名为 now、uuid 等的变量不会被函数覆盖
+func (c *command) eval(vars map[string]interface{}, piped interface{}, hasPiped bool) (interface{}, error) {
+	first := c.terms[0]
+	if first.kind == termIdent && !first.variable && (len(c.terms) > 1 || hasPiped) {
+		if fn, ok := lookupFunc(first.ident); ok {
+			args := make([]interface{}, 0, len(c.terms))
+			for _, t := range c.terms[1:] {
+				v, err := t.eval(vars)
+				if err != nil {
+					return nil, err
+				}
+				if m, isMissing := v.(missingValue); isMissing && !lenientFuncs[first.ident] {
+					return nil, &MissingError{Name: m.name}
+				}
+				args = append(args, v)
+			}
+			if hasPiped {
+				args = append(args, piped)
+			}
+			v, err := fn(args...)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", first.ident, err)
+			}
+			return v, nil
+		}
+	}
+
+	if len(c.terms) > 1 {
+		return nil, fmt.Errorf("未知函数 %q", first.ident)
+	}
+	if hasPiped {
+		return nil, fmt.Errorf("%q 不是函数，不能接收管道输入", first.ident)
+	}
+	return first.eval(vars)
+}
+
+func (t *term) eval(vars map[string]interface{}) (interface{}, error) {
+	switch t.kind {
+	case termLiteral:
+		return t.literal, nil
+	case termPipeline:
+		v, err := t.sub.eval(vars)
+		if err != nil {
+			if missing, ok := err.(*MissingError); ok {
+				return missingValue{name: missing.Name}, nil
+			}
+			return nil, err
+		}
+		return v, nil
+	default:
+		if v, ok := Lookup(vars, t.ident); ok {
+			return v, nil
+		}
+		if fn, ok := lookupFunc(t.ident); ok && !t.variable {
+			v, err := fn()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", t.ident, err)
+			}
+			return v, nil
+		}
+		return missingValue{name: t.ident}, nil
+	}
+}
+
+// collectVars 把表达式引用的变量的第一段名称加入 set。函数名不计入；
+// 与函数同名的单独标识符会先按变量查找，所以计入
+func (p *pipeline) collectVars(set map[string]bool) {
+	for j, cmd := range p.commands {
+		for i, t := range cmd.terms {
+			if i == 0 && (len(cmd.terms) > 1 || j > 0) && t.kind == termIdent && !t.variable {
+				// 函数名
+				continue
+			}
+			t.collectVars(set)
+		}
+	}
+}
+
+func (t *term) collectVars(set map[string]bool) {
+	switch t.kind {
+	case termPipeline:
+		t.sub.collectVars(set)
+	case termIdent:
+		name, _, _ := strings.Cut(t.ident, ".")
+		set[name] = true
+	}
+}
@@ -0,0 +1,307 @@
+// Package template 实现请求模板引擎。模板中 {{ }} 内是表达式，支持变量引用（a.b.0.c）、
+// 字符串和数字字面量、函数调用（{{randInt 1 100}}）、括号嵌套和管道（{{token | base64}}）。
+// 当整个字符串只有一个表达式时保留表达式结果的类型，否则把结果插值到字符串中。
+package template
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MissingError 表示模板引用了不存在的变量
+type MissingError struct {
+	Name string
+}
+
+func (e *MissingError) Error() string {
+	return fmt.Sprintf("变量 %s 不存在", e.Name)
+}
+
+// IsMissing 返回 err 是否由引用不存在的变量引起
+func IsMissing(err error) bool {
+	var missing *MissingError
+	return errors.As(err, &missing)
+}
+
+// Template 是编译后的字符串模板
+type Template struct {
+	source string
+	parts  []part
+}
+
+// part 是模板的一个片段，literal 和 expr 只有一个有效
+type part struct {
+	literal string
+	expr    *pipeline
+}
+
+// Compile 编译字符串模板
+func Compile(source string) (*Template, error) {
+	t := &Template{source: source}
+	rest := source
+	for {
+		start := strings.Index(rest, "{{")
+		if start < 0 {
+			if rest != "" {
+				t.parts = append(t.parts, part{literal: rest})
+			}
+			return t, nil
+		}
+		end := closeDelim(rest[start+2:])
+		if end < 0 {
+			return nil, fmt.Errorf("模板 %q 缺少 }}", source)
+		}
+		end += start + 2
+
+		if start > 0 {
+			t.parts = append(t.parts, part{literal: rest[:start]})
+		}
+		expr, err := parseExpression(rest[start+2 : end])
+		if err != nil {
+			return nil, fmt.Errorf("模板 %q: %w", source, err)
+		}
+		t.parts = append(t.parts, part{expr: expr})
+		rest = rest[end+2:]
+	}
+}
+
+// closeDelim 返回 s 中第一个不在字符串字面量内的 }} 的位置，没有时返回 -1，
+// 这样 {{ "a}}b" }} 中字符串里的 }} 不会被当作表达式的结束
+func closeDelim(s string) int {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == '"' && c == '\\':
+			// 双引号字符串中的转义字符
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '}' && i+1 < len(s) && s[i+1] == '}':
+			return i
+		}
+	}
+	return -1
+}
+
+// MustCompile 编译模板，失败时 panic，用于程序内置的模板
+func MustCompile(source string) *Template {
+	t, err := Compile(source)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// IsStatic 返回模板是否不包含任何表达式
+func (t *Template) IsStatic() bool {
+	return len(t.parts) == 0 || (len(t.parts) == 1 && t.parts[0].expr == nil)
+}
+
+// Source 返回模板源码
+func (t *Template) Source() string {
+	return t.source
+}
+
+// Vars 返回模板引用的变量名，带路径的变量（如 wallets.walletAddr）只返回第一段
+func (t *Template) Vars() []string {
+	set := make(map[string]bool)
+	t.collectVars(set)
+	return setToSlice(set)
+}
+
+func (t *Template) collectVars(set map[string]bool) {
+	for _, p := range t.parts {
+		if p.expr != nil {
+			p.expr.collectVars(set)
+		}
+	}
+}
+
+func setToSlice(set map[string]bool) []string {
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Execute 渲染模板。整个模板只有一个表达式时返回表达式结果本身（保留数字、对象等类型），
+// 引用的变量不存在时返回 *MissingError；否则返回插值后的字符串，不存在的变量插值为空字符串
+func (t *Template) Execute(vars map[string]interface{}) (interface{}, error) {
+	return t.execute(vars, false)
+}
+
+// Render 渲染模板并转换为字符串
+func (t *Template) Render(vars map[string]interface{}) (string, error) {
+	v, err := t.Execute(vars)
+	if err != nil {
+		return "", err
+	}
+	return ToString(v), nil
+}
+
+// RenderStrict 与 Render 相同，但插值的表达式引用了不存在的变量时也返回 *MissingError，
+// 用于变量不存在时需要整体省略的值，如 "Bearer {{token}}" 形式的请求头
+func (t *Template) RenderStrict(vars map[string]interface{}) (string, error) {
+	v, err := t.execute(vars, true)
+	if err != nil {
+		return "", err
+	}
+	return ToString(v), nil
+}
+
+func (t *Template) execute(vars map[string]interface{}, strict bool) (interface{}, error) {
+	if len(t.parts) == 1 && t.parts[0].expr != nil {
+		return t.parts[0].expr.eval(vars)
+	}
+
+	var b strings.Builder
+	for _, p := range t.parts {
+		if p.expr == nil {
+			b.WriteString(p.literal)
+			continue
+		}
+		v, err := p.expr.eval(vars)
+		if err != nil {
+			if IsMissing(err) && !strict {
+				continue
+			}
+			return nil, err
+		}
+		b.WriteString(ToString(v))
+	}
+	return b.String(), nil
+}
+
+// Expr 是编译后的单个表达式，用于条件判断等需要反复求值的场合
+type Expr struct {
+	source string
+	p      *pipeline
+}
+
+// CompileExpr 编译 {{ }} 内的表达式，expr 两侧的 {{ }} 可以省略
+func CompileExpr(expr string) (*Expr, error) {
+	source := strings.TrimSpace(expr)
+	if strings.HasPrefix(source, "{{") && strings.HasSuffix(source, "}}") {
+		source = source[2 : len(source)-2]
+	}
+	p, err := parseExpression(source)
+	if err != nil {
+		return nil, fmt.Errorf("表达式 %q: %w", expr, err)
+	}
+	return &Expr{source: expr, p: p}, nil
+}
+
+// Vars 返回表达式引用的变量名，规则同 Template.Vars
+func (e *Expr) Vars() []string {
+	set := make(map[string]bool)
+	e.p.collectVars(set)
+	return setToSlice(set)
+}
+
+// Eval 对表达式求值，引用的变量不存在时返回 *MissingError
+func (e *Expr) Eval(vars map[string]interface{}) (interface{}, error) {
+	return e.p.eval(vars)
+}
+
+// String 返回表达式源码
+func (e *Expr) String() string {
+	return e.source
+}
+
+// Eval 把 expr 当作 {{ }} 内的表达式求值
+func Eval(expr string, vars map[string]interface{}) (interface{}, error) {
+	e, err := CompileExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+	return e.Eval(vars)
+}
+
+// Truthy 返回表达式结果作为条件时是否为真：false、nil、0、空字符串、"false"、空数组和空对象为假
+func Truthy(v interface{}) bool {
+	switch value := v.(type) {
+	case nil, missingValue:
+		return false
+	case bool:
+		return value
+	case string:
+		return value != "" && value != "false" && value != "0"
+	case []interface{}:
+		return len(value) > 0
+	case map[string]interface{}:
+		return len(value) > 0
+	}
+	if f, ok := toFloat(v); ok {
+		return f != 0
+	}
+	return true
+}
+
+// ToString 把表达式结果转换为字符串，对象和数组编码为 JSON
+func ToString(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case []byte:
+		return string(value)
+	case json.Number:
+		return value.String()
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(value), 'f', -1, 32)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, bool:
+		return fmt.Sprint(value)
+	case fmt.Stringer:
+		return value.String()
+	default:
+		data, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Sprint(value)
+		}
+		return string(data)
+	}
+}
+
+// Lookup 按点分隔的路径在 vars 中查找变量，路径中的数字段用于索引数组
+func Lookup(vars map[string]interface{}, path string) (interface{}, bool) {
+	segments := strings.Split(path, ".")
+	current, ok := vars[segments[0]]
+	if !ok {
+		return nil, false
+	}
+
+	for _, segment := range segments[1:] {
+		switch value := current.(type) {
+		case map[string]interface{}:
+			current, ok = value[segment]
+		case map[string]string:
+			current, ok = value[segment]
+		case []interface{}:
+			index, err := strconv.Atoi(segment)
+			ok = err == nil && index >= 0 && index < len(value)
+			if ok {
+				current = value[index]
+			}
+		default:
+			ok = false
+		}
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
@@ -0,0 +1,214 @@
+package template
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestRenderStrict(t *testing.T) {
+	tmpl := MustCompile("Bearer {{token}}")
+	if got, err := tmpl.Render(nil); err != nil || got != "Bearer " {
+		t.Errorf("Render = %q, %v", got, err)
+	}
+	if _, err := tmpl.RenderStrict(nil); !IsMissing(err) {
+		t.Errorf("RenderStrict 的 err = %v，期望 *MissingError", err)
+	}
+	got, err := tmpl.RenderStrict(map[string]interface{}{"token": "abc"})
+	if err != nil || got != "Bearer abc" {
+		t.Errorf("RenderStrict = %q, %v", got, err)
+	}
+	// 宽松函数处理不存在的变量时不算缺失
+	got, err = MustCompile(`v={{default "x" missing}}`).RenderStrict(nil)
+	if err != nil || got != "v=x" {
+		t.Errorf("RenderStrict = %q, %v", got, err)
+	}
+}
+
+// TestVarsBeforeFuncs 检查与无参函数同名的变量在任何位置都优先于函数
+func TestVarsBeforeFuncs(t *testing.T) {
+	vars := map[string]interface{}{"now": "csv-now", "uuid": "csv-uuid"}
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"{{now}}", "csv-now"},
+		{"{{ uuid }}", "csv-uuid"},
+		{"{{.now}}", "csv-now"},
+		{"{{(now)}}", "csv-now"},
+		{"{{upper now}}", "CSV-NOW"},
+		{"{{now | upper}}", "CSV-NOW"},
+		{"id-{{uuid}}", "id-csv-uuid"},
+	}
+	for _, tt := range tests {
+		got, err := MustCompile(tt.source).Render(vars)
+		if err != nil || got != tt.want {
+			t.Errorf("%s = %q, %v, want %q", tt.source, got, err, tt.want)
+		}
+	}
+
+	// 没有同名变量时调用函数，带参数时总是函数调用
+	if got, err := MustCompile("{{uuid}}").Render(nil); err != nil || len(got) != 36 {
+		t.Errorf("{{uuid}} = %q, %v", got, err)
+	}
+	if got, err := MustCompile(`{{now "unix"}}`).Render(vars); err != nil || got == "csv-now" {
+		t.Errorf(`{{now "unix"}} = %q, %v`, got, err)
+	}
+	if got := MustCompile("{{now}}").Vars(); len(got) != 1 || got[0] != "now" {
+		t.Errorf("Vars = %v", got)
+	}
+	if got := MustCompile("{{token | base64}}").Vars(); len(got) != 1 || got[0] != "token" {
+		t.Errorf("Vars = %v", got)
+	}
+}
+
+func TestExecute(t *testing.T) {
+	vars := map[string]interface{}{
+		"name":  "bob",
+		"id":    json.Number("12345678901234567890"),
+		"count": int64(3),
+		"user":  map[string]interface{}{"id": json.Number("7"), "tags": []interface{}{"a", "b"}},
+		"items": []interface{}{map[string]interface{}{"sku": "x1"}, map[string]interface{}{"sku": "y2"}},
+		"flag":  false,
+	}
+	tests := []struct {
+		source string
+		want   interface{}
+	}{
+		// 没有表达式
+		{"hello", "hello"},
+		{"", ""},
+		// 整个模板只有一个表达式时保留类型
+		{"{{name}}", "bob"},
+		{"{{id}}", json.Number("12345678901234567890")},
+		{"{{count}}", int64(3)},
+		{"{{flag}}", false},
+		{"{{user}}", vars["user"]},
+		{"{{user.tags}}", []interface{}{"a", "b"}},
+		{"{{ items.1.sku }}", "y2"},
+		{"{{ 42 }}", int64(42)},
+		{"{{ -1.5 }}", -1.5},
+		{"{{ true }}", true},
+		{"{{ null }}", nil},
+		// 插值时转换为字符串，对象编码为 JSON
+		{"id={{id}}", "id=12345678901234567890"},
+		{"{{name}}-{{count}}", "bob-3"},
+		{"u={{user.tags}}", `u=["a","b"]`},
+		// 字符串字面量中的 }} 和引号
+		{`{{ "a}}b" }}`, "a}}b"},
+		{`x{{ 'a}}b' }}y`, "xa}}by"},
+		{`{{ "q\"}}" }}`, `q"}}`},
+		{`{{"}}"}}{{name}}`, "}}bob"},
+		// 函数、管道和括号
+		{"{{ name | upper }}", "BOB"},
+		{"{{ name | upper | base64 }}", "Qk9C"},
+		{`{{ upper (default "x" missing) }}`, "X"},
+		{"{{ len user.tags }}", int64(2)},
+		{"{{ eq count 3 }}", true},
+		{`{{ and (exists name) (not (exists missing)) }}`, true},
+		{`{{ int "12" }}`, int64(12)},
+		{`{{ randInt 5 5 }}`, int64(5)},
+		// 插值中不存在的变量为空字符串
+		{"a{{missing}}b", "ab"},
+	}
+	for _, tt := range tests {
+		tmpl, err := Compile(tt.source)
+		if err != nil {
+			t.Errorf("Compile(%q): %v", tt.source, err)
+			continue
+		}
+		got, err := tmpl.Execute(vars)
+		if err != nil {
+			t.Errorf("Execute(%q): %v", tt.source, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Execute(%q) = %#v, want %#v", tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestExecuteErrors(t *testing.T) {
+	tests := []struct {
+		source  string
+		missing bool
+	}{
+		{"{{missing}}", true},
+		{"{{user.missing}}", true},
+		{"{{ upper missing }}", true},
+		{"{{ missing | upper }}", true},
+		{"{{ unknownFunc 1 }}", false},
+		{"{{ name | notAFunc }}", false},
+		{`{{ int "x" }}`, false},
+	}
+	vars := map[string]interface{}{"name": "bob", "notAFunc": "v", "user": map[string]interface{}{}}
+	for _, tt := range tests {
+		_, err := MustCompile(tt.source).Execute(vars)
+		if err == nil {
+			t.Errorf("Execute(%q) 期望返回错误", tt.source)
+			continue
+		}
+		if IsMissing(err) != tt.missing {
+			t.Errorf("Execute(%q) = %v，IsMissing 应为 %v", tt.source, err, tt.missing)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, source := range []string{
+		"{{name",
+		"{{ }}",
+		"{{ name ) }}",
+		"{{ (name }}",
+		"{{ a | }}",
+		"{{ | a }}",
+		`{{ "unterminated }}`,
+		`{{ 'unterminated }}`,
+		"{{ a # b }}",
+		"{{ . }}",
+	} {
+		if _, err := Compile(source); err == nil {
+			t.Errorf("Compile(%q) 期望返回错误", source)
+		}
+	}
+}
+
+func TestVars(t *testing.T) {
+	tests := []struct {
+		source string
+		want   []string
+	}{
+		{"static", []string{}},
+		{"{{a.b.c}}-{{d}}", []string{"a", "d"}},
+		{`{{ upper (default "x" e) }}`, []string{"e"}},
+		{"{{ f | base64 | upper }}", []string{"f"}},
+		{`{{ randInt 1 10 }}`, []string{}},
+	}
+	for _, tt := range tests {
+		if got := MustCompile(tt.source).Vars(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Vars(%q) = %v, want %v", tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestJSONTemplate(t *testing.T) {
+	tmpl, err := CompileJSON([]byte(`{
+		"id": "{{id}}",
+		"name": "user-{{name}}",
+		"note": "{{note}}",
+		"{{key}}": 1,
+		"items": ["{{name}}", "{{missing}}", 2],
+		"fixed": {"n": 1.50}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := tmpl.Render(map[string]interface{}{"id": json.Number("12345678901234567890"), "name": "bob", "key": "k"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"fixed":{"n":1.50},"id":12345678901234567890,"items":["bob",null,2],"k":1,"name":"user-bob"}`
+	if string(got) != want {
+		t.Errorf("Render =\n%s\nwant\n%s", got, want)
+	}
+}
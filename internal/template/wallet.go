@@ -0,0 +1,133 @@
+package template
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/tyxben/goloadtest/internal/auth"
+	"github.com/tyxben/goloadtest/pkg/siwe"
+)
+
+// 以太坊钱包相关的模板函数
+func init() {
+	funcs["personalSign"] = personalSignFunc
+	funcs["walletAddress"] = walletAddressFunc
+	funcs["loginMessage"] = loginMessageFunc
+	funcs["siweMessage"] = siweMessageFunc
+	funcs["siweNonce"] = siweNonceFunc
+	funcs["signTypedData"] = signTypedDataFunc
+	funcs["hashTypedData"] = hashTypedDataFunc
+}
+
+// personalSignFunc 用私钥按 EIP-191 对消息签名：personalSign 私钥 消息，
+// 也可以写成 {{text | personalSign privateKey}}
+func personalSignFunc(args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 2, 2); err != nil {
+		return nil, err
+	}
+	return auth.PersonalSign(ToString(args[1]), ToString(args[0]))
+}
+
+// walletAddressFunc 返回私钥对应的钱包地址
+func walletAddressFunc(args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return nil, err
+	}
+	return auth.WalletAddress(ToString(args[0]))
+}
+
+// loginMessageFunc 生成钱包登录的挑战消息，可选参数为服务端下发的 nonce
+func loginMessageFunc(args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 0, 1); err != nil {
+		return nil, err
+	}
+	nonce := ""
+	if len(args) == 1 {
+		nonce = ToString(args[0])
+	}
+	return auth.LoginMessage(nonce)
+}
+
+// siweMessageFunc 生成 EIP-4361 登录消息：siweMessage 域名 地址 URI 链ID [nonce [声明 [有效期]]]。
+// nonce 为空时随机生成，有效期为 Go 时长格式（如 10m），为空时消息不带过期时间
+func siweMessageFunc(args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 4, 7); err != nil {
+		return nil, err
+	}
+	chainID, err := ToInt(args[3])
+	if err != nil {
+		return nil, fmt.Errorf("链 ID: %w", err)
+	}
+	msg := siwe.Message{
+		Domain:   ToString(args[0]),
+		Address:  ToString(args[1]),
+		URI:      ToString(args[2]),
+		ChainID:  chainID,
+		IssuedAt: time.Now(),
+	}
+	if len(args) > 4 {
+		msg.Nonce = ToString(args[4])
+	}
+	if msg.Nonce == "" {
+		if msg.Nonce, err = siwe.Nonce(); err != nil {
+			return nil, err
+		}
+	}
+	if len(args) > 5 {
+		msg.Statement = ToString(args[5])
+	}
+	if len(args) > 6 && ToString(args[6]) != "" {
+		ttl, err := time.ParseDuration(ToString(args[6]))
+		if err != nil {
+			return nil, fmt.Errorf("有效期: %w", err)
+		}
+		msg.ExpirationTime = msg.IssuedAt.Add(ttl)
+	}
+	return msg.String(), nil
+}
+
+// siweNonceFunc 生成随机的 SIWE nonce
+func siweNonceFunc(args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 0, 0); err != nil {
+		return nil, err
+	}
+	return siwe.Nonce()
+}
+
+// signTypedDataFunc 按 EIP-712 对结构化数据签名：signTypedData 私钥 数据。
+// 数据可以是 JSON 字符串，也可以是从响应中提取的对象
+func signTypedDataFunc(args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 2, 2); err != nil {
+		return nil, err
+	}
+	data, err := typedDataJSON(args[1])
+	if err != nil {
+		return nil, err
+	}
+	return auth.SignTypedData(data, ToString(args[0]))
+}
+
+// hashTypedDataFunc 返回 EIP-712 结构化数据的签名哈希
+func hashTypedDataFunc(args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return nil, err
+	}
+	data, err := typedDataJSON(args[0])
+	if err != nil {
+		return nil, err
+	}
+	hash, err := auth.HashTypedData(data)
+	if err != nil {
+		return nil, err
+	}
+	return hexutil.Encode(hash), nil
+}
+
+func typedDataJSON(v interface{}) ([]byte, error) {
+	if s, ok := v.(string); ok {
+		return []byte(s), nil
+	}
+	return json.Marshal(v)
+}
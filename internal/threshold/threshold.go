@@ -0,0 +1,445 @@
+package threshold
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tyxben/goloadtest/internal/stats"
+	"github.com/tyxben/goloadtest/pkg/config"
+)
+
+type metricKind int
+
+const (
+	// trend 类指标是时长分布，支持 avg、min、max、med、p(N)
+	trend metricKind = iota
+	// rate 类指标是 0-1 之间的比例
+	rate
+	// counter 类指标是计数，支持 count 和 rate（每秒次数）
+	counter
+)
+
+// metricDef 描述一个指标的类型和可以使用的标签
+type metricDef struct {
+	kind metricKind
+	tags []string
+}
+
+// metricDefs 列出支持的指标。迭代类指标没有 api 维度；丢弃和延迟启动的迭代只有整体计数
+var metricDefs = map[string]metricDef{
+	"http_req_duration":  {trend, []string{"api", "scenario"}},
+	"iteration_duration": {trend, []string{"scenario"}},
+	"http_req_failed":    {rate, []string{"api", "scenario"}},
+	"error_rate":         {rate, []string{"api", "scenario"}},
+	"checks":             {rate, []string{"api", "check"}},
+	"http_reqs":          {counter, []string{"api", "scenario"}},
+	"iterations":         {counter, []string{"scenario"}},
+	"dropped_iterations": {counter, nil},
+	"late_iterations":    {counter, nil},
+}
+
+var (
+	metricPattern     = regexp.MustCompile(`^\s*([a-z_]+)\s*(?:\{([^}]*)\})?\s*$`)
+	expressionPattern = regexp.MustCompile(`^\s*(avg|min|max|med|count|rate|p\(\s*([0-9.]+)\s*\))?\s*(<=|>=|==|!=|<|>)\s*([0-9.]+)\s*(ms|s|m|us|µs)?\s*$`)
+)
+
+// Result 是一条阈值规则的检查结果
+type Result struct {
+	Metric    string
+	Threshold string
+	Actual    string
+	Passed    bool
+	// NoData 表示指标没有数据（如标签指定的 API 没有请求），规则被跳过，不计为未通过
+	NoData      bool
+	AbortOnFail bool
+}
+
+type metric struct {
+	name string
+	kind metricKind
+	tags map[string]string
+}
+
+type expression struct {
+	aggregation string
+	percentile  float64
+	operator    string
+	value       float64
+}
+
+// Validate 检查所有阈值的指标名和表达式是否合法
+func Validate(thresholds map[string][]config.ThresholdRule) error {
+	for key, rules := range thresholds {
+		m, err := parseMetric(key)
+		if err != nil {
+			return err
+		}
+		for _, rule := range rules {
+			if _, err := parseExpression(m.kind, rule.Threshold); err != nil {
+				return fmt.Errorf("阈值 %s: %w", key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Evaluate 根据统计结果检查所有阈值，elapsed 是已运行时长，用于计算每秒速率。
+// 结果按指标名排序，同一指标内保持配置顺序
+func Evaluate(thresholds map[string][]config.ThresholdRule, s *stats.Stats, elapsed time.Duration) []Result {
+	keys := make([]string, 0, len(thresholds))
+	for key := range thresholds {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var results []Result
+	for _, key := range keys {
+		for _, rule := range thresholds[key] {
+			result, _ := evaluate(key, rule, s, elapsed)
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// CheckAbort 在运行期间检查带 abortOnFail 的阈值，返回第一条不满足的规则。
+// 尚未超过 delayAbortEval 或还没有数据的规则会被跳过
+func CheckAbort(thresholds map[string][]config.ThresholdRule, s *stats.Stats, elapsed time.Duration) (Result, bool) {
+	for key, rules := range thresholds {
+		for _, rule := range rules {
+			if !rule.AbortOnFail || elapsed < rule.DelayAbortEval.Std() {
+				continue
+			}
+			result, hasData := evaluate(key, rule, s, elapsed)
+			if hasData && !result.Passed {
+				return result, true
+			}
+		}
+	}
+	return Result{}, false
+}
+
+// Failed 返回是否有阈值未通过，没有数据而跳过的规则不算未通过
+func Failed(results []Result) bool {
+	for _, r := range results {
+		if !r.Passed && !r.NoData {
+			return true
+		}
+	}
+	return false
+}
+
+// Print 以清单形式输出阈值检查结果
+func Print(out io.Writer, results []Result) {
+	if len(results) == 0 {
+		return
+	}
+
+	fmt.Fprintf(out, "\n阈值检查:\n")
+	for _, r := range results {
+		mark := "✓"
+		switch {
+		case r.NoData:
+			mark = "-"
+		case !r.Passed:
+			mark = "✗"
+		}
+		fmt.Fprintf(out, "%s %s: %s（实际值: %s）\n", mark, r.Metric, r.Threshold, r.Actual)
+	}
+}
+
+func evaluate(key string, rule config.ThresholdRule, s *stats.Stats, elapsed time.Duration) (result Result, hasData bool) {
+	result = Result{
+		Metric:      key,
+		Threshold:   rule.Threshold,
+		AbortOnFail: rule.AbortOnFail,
+	}
+
+	m, err := parseMetric(key)
+	if err != nil {
+		result.Actual = err.Error()
+		return result, false
+	}
+	expr, err := parseExpression(m.kind, rule.Threshold)
+	if err != nil {
+		result.Actual = err.Error()
+		return result, false
+	}
+
+	actual, display, ok := value(m, expr, s, elapsed)
+	if !ok {
+		result.Actual = "无数据"
+		result.NoData = true
+		return result, false
+	}
+	result.Actual = display
+	result.Passed = compare(actual, expr.operator, expr.value)
+	return result, true
+}
+
+// value 计算指标在表达式聚合方式下的值，trend 类指标以毫秒为单位
+func value(m metric, expr expression, s *stats.Stats, elapsed time.Duration) (actual float64, display string, ok bool) {
+	switch m.kind {
+	case trend:
+		h := histogramFor(m, s)
+		if h == nil || h.Count() == 0 {
+			return 0, "", false
+		}
+		var d time.Duration
+		switch expr.aggregation {
+		case "avg":
+			d = h.Mean()
+		case "min":
+			d = h.Min()
+		case "max":
+			d = h.Max()
+		case "med":
+			d = h.Percentile(50)
+		default:
+			d = h.Percentile(expr.percentile)
+		}
+		return float64(d) / float64(time.Millisecond), d.String(), true
+
+	case rate:
+		matched, total, found := rateCounts(m, s)
+		if !found || total == 0 {
+			return 0, "", false
+		}
+		r := float64(matched) / float64(total)
+		return r, strconv.FormatFloat(r, 'f', 4, 64), true
+
+	default:
+		count := counterValue(m, s)
+		if expr.aggregation == "rate" {
+			if elapsed <= 0 {
+				return 0, "", false
+			}
+			r := float64(count) / elapsed.Seconds()
+			return r, strconv.FormatFloat(r, 'f', 2, 64) + "/s", true
+		}
+		return float64(count), strconv.Itoa(count), true
+	}
+}
+
+func histogramFor(m metric, s *stats.Stats) *stats.Histogram {
+	if scenario, ok := m.tags["scenario"]; ok {
+		metrics := scenarioMetrics(m, s, scenario)
+		if metrics == nil {
+			return nil
+		}
+		return metrics.Latency
+	}
+	if m.name == "iteration_duration" {
+		return s.Transactions.Latency
+	}
+	if api, ok := m.tags["api"]; ok {
+		if metrics, ok := s.APIs[api]; ok {
+			return metrics.Latency
+		}
+		return nil
+	}
+	return s.Latency
+}
+
+// rateCounts 返回比例类指标的分子和分母：checks 为通过的断言数，其余为失败的请求数
+func rateCounts(m metric, s *stats.Stats) (matched, total int, found bool) {
+	if m.name == "checks" {
+		return checkCounts(m, s)
+	}
+	if scenario, ok := m.tags["scenario"]; ok {
+		metrics := scenarioMetrics(m, s, scenario)
+		if metrics == nil {
+			return 0, 0, false
+		}
+		return metrics.Failed, metrics.Count, true
+	}
+	if api, ok := m.tags["api"]; ok {
+		metrics, ok := s.APIs[api]
+		if !ok {
+			return 0, 0, false
+		}
+		return metrics.Failed, metrics.Count, true
+	}
+	return s.FailedRequests, s.TotalRequests, true
+}
+
+func checkCounts(m metric, s *stats.Stats) (passed, total int, found bool) {
+	api, hasAPI := m.tags["api"]
+	check, hasCheck := m.tags["check"]
+	if !hasAPI && !hasCheck {
+		return s.ChecksPassed, s.ChecksPassed + s.ChecksFailed, true
+	}
+
+	for name, metrics := range s.APIs {
+		if hasAPI && name != api {
+			continue
+		}
+		for checkName, count := range metrics.Checks {
+			if hasCheck && checkName != check {
+				continue
+			}
+			passed += count.Passes
+			total += count.Passes + count.Fails
+			found = true
+		}
+	}
+	return passed, total, found
+}
+
+func counterValue(m metric, s *stats.Stats) int {
+	if scenario, ok := m.tags["scenario"]; ok {
+		if metrics := scenarioMetrics(m, s, scenario); metrics != nil {
+			return metrics.Count
+		}
+		return 0
+	}
+	switch m.name {
+	case "iterations":
+		return s.Transactions.Count
+	case "dropped_iterations":
+		return s.DroppedIterations
+	case "late_iterations":
+		return s.LateIterations
+	}
+	if api, ok := m.tags["api"]; ok {
+		if metrics, ok := s.APIs[api]; ok {
+			return metrics.Count
+		}
+		return 0
+	}
+	return s.TotalRequests
+}
+
+// scenarioMetrics 返回带 scenario 标签的指标对应的场景统计：迭代类指标为工作流迭代，其余为请求
+func scenarioMetrics(m metric, s *stats.Stats, scenario string) *stats.Metrics {
+	sm, ok := s.Scenarios[scenario]
+	if !ok {
+		return nil
+	}
+	if m.name == "iteration_duration" || m.name == "iterations" {
+		return sm.Iterations
+	}
+	return sm.Requests
+}
+
+func compare(actual float64, operator string, expected float64) bool {
+	switch operator {
+	case "<":
+		return actual < expected
+	case "<=":
+		return actual <= expected
+	case ">":
+		return actual > expected
+	case ">=":
+		return actual >= expected
+	case "==":
+		return actual == expected
+	default:
+		return actual != expected
+	}
+}
+
+// parseMetric 解析 name{key:value,...} 形式的指标名
+func parseMetric(key string) (metric, error) {
+	match := metricPattern.FindStringSubmatch(key)
+	if match == nil {
+		return metric{}, fmt.Errorf("无效的指标 %q", key)
+	}
+	def, ok := metricDefs[match[1]]
+	if !ok {
+		return metric{}, fmt.Errorf("不支持的指标 %q", match[1])
+	}
+
+	m := metric{name: match[1], kind: def.kind, tags: make(map[string]string)}
+	if match[2] != "" {
+		for _, pair := range strings.Split(match[2], ",") {
+			k, v, ok := strings.Cut(pair, ":")
+			if !ok {
+				return metric{}, fmt.Errorf("无效的标签 %q", pair)
+			}
+			k = strings.TrimSpace(k)
+			// 指标不支持的标签不会生效，阈值实际检查的是整体指标，所以要报错
+			if !supportsTag(def, k) {
+				if len(def.tags) == 0 {
+					return metric{}, fmt.Errorf("指标 %q 中不支持的标签 %q，指标 %s 不能带标签", key, k, m.name)
+				}
+				return metric{}, fmt.Errorf("指标 %q 中不支持的标签 %q，可用的标签为 %s", key, k, strings.Join(def.tags, "、"))
+			}
+			m.tags[k] = strings.TrimSpace(v)
+		}
+	}
+	if _, ok := m.tags["scenario"]; ok {
+		if _, hasAPI := m.tags["api"]; hasAPI {
+			return metric{}, fmt.Errorf("指标 %q 不能同时使用 api 和 scenario 标签", key)
+		}
+	}
+	return m, nil
+}
+
+func supportsTag(def metricDef, tag string) bool {
+	for _, t := range def.tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func parseExpression(kind metricKind, expr string) (expression, error) {
+	match := expressionPattern.FindStringSubmatch(expr)
+	if match == nil {
+		return expression{}, fmt.Errorf("无效的阈值表达式 %q", expr)
+	}
+
+	e := expression{aggregation: match[1], operator: match[3]}
+	if strings.HasPrefix(e.aggregation, "p(") {
+		e.aggregation = "p"
+		p, err := strconv.ParseFloat(match[2], 64)
+		if err != nil || p < 0 || p > 100 {
+			return expression{}, fmt.Errorf("无效的百分位 %q", match[2])
+		}
+		e.percentile = p
+	}
+	value, err := strconv.ParseFloat(match[4], 64)
+	if err != nil {
+		return expression{}, fmt.Errorf("无效的阈值 %q", match[4])
+	}
+	e.value = value
+
+	switch kind {
+	case trend:
+		switch e.aggregation {
+		case "avg", "min", "max", "med", "p":
+		default:
+			return expression{}, fmt.Errorf("时长类指标需要 avg、min、max、med 或 p(N) 聚合: %q", expr)
+		}
+		switch match[5] {
+		case "s":
+			e.value *= 1000
+		case "m":
+			e.value *= 60 * 1000
+		case "us", "µs":
+			e.value /= 1000
+		}
+	case rate:
+		if e.aggregation != "" && e.aggregation != "rate" {
+			return expression{}, fmt.Errorf("比例类指标只支持 rate 聚合: %q", expr)
+		}
+		if match[5] != "" {
+			return expression{}, fmt.Errorf("比例类指标不能带单位: %q", expr)
+		}
+	case counter:
+		if e.aggregation != "" && e.aggregation != "count" && e.aggregation != "rate" {
+			return expression{}, fmt.Errorf("计数类指标只支持 count 或 rate 聚合: %q", expr)
+		}
+		if match[5] != "" {
+			return expression{}, fmt.Errorf("计数类指标不能带单位: %q", expr)
+		}
+	}
+	return e, nil
+}
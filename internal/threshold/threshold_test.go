@@ -0,0 +1,239 @@
+package threshold
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tyxben/goloadtest/internal/stats"
+	"github.com/tyxben/goloadtest/internal/worker"
+	"github.com/tyxben/goloadtest/pkg/config"
+)
+
+func TestParseMetric(t *testing.T) {
+	tests := []struct {
+		key  string
+		name string
+		tags map[string]string
+		// err 不为空时期望解析失败，且错误信息包含 err
+		err string
+	}{
+		{key: "http_req_duration", name: "http_req_duration"},
+		{key: " http_req_duration{api: login} ", name: "http_req_duration", tags: map[string]string{"api": "login"}},
+		{key: "http_reqs{scenario:browse}", name: "http_reqs", tags: map[string]string{"scenario": "browse"}},
+		{key: "iteration_duration{scenario:buy}", name: "iteration_duration", tags: map[string]string{"scenario": "buy"}},
+		{key: "checks{api:login,check:status}", name: "checks", tags: map[string]string{"api": "login", "check": "status"}},
+		{key: "error_rate{api:login}", name: "error_rate", tags: map[string]string{"api": "login"}},
+
+		{key: "http_req_latency", err: "不支持的指标"},
+		{key: "http_req_duration{api}", err: "无效的标签"},
+		{key: "http_req_duration{url:/x}", err: "可用的标签为 api、scenario"},
+		// 迭代类指标没有 api 维度
+		{key: "iteration_duration{api:x}", err: "可用的标签为 scenario"},
+		{key: "iterations{api:x}", err: "不支持的标签"},
+		{key: "http_req_duration{check:x}", err: "不支持的标签"},
+		{key: "checks{scenario:a}", err: "可用的标签为 api、check"},
+		{key: "dropped_iterations{scenario:a}", err: "不能带标签"},
+		{key: "late_iterations{api:x}", err: "不能带标签"},
+		{key: "http_reqs{api:x,scenario:a}", err: "不能同时使用"},
+		{key: "HTTP_REQS", err: "无效的指标"},
+	}
+	for _, tt := range tests {
+		m, err := parseMetric(tt.key)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: err = %v，期望包含 %q", tt.key, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.key, err)
+			continue
+		}
+		if m.name != tt.name {
+			t.Errorf("%s: name = %q，期望 %q", tt.key, m.name, tt.name)
+		}
+		if len(m.tags) != len(tt.tags) {
+			t.Errorf("%s: tags = %v，期望 %v", tt.key, m.tags, tt.tags)
+		}
+		for k, v := range tt.tags {
+			if m.tags[k] != v {
+				t.Errorf("%s: 标签 %s = %q，期望 %q", tt.key, k, m.tags[k], v)
+			}
+		}
+	}
+}
+
+func TestParseExpression(t *testing.T) {
+	tests := []struct {
+		kind metricKind
+		expr string
+		want expression
+		err  bool
+	}{
+		{kind: trend, expr: "p(95)<300", want: expression{aggregation: "p", percentile: 95, operator: "<", value: 300}},
+		{kind: trend, expr: "p(99.9) <= 1s", want: expression{aggregation: "p", percentile: 99.9, operator: "<=", value: 1000}},
+		{kind: trend, expr: "avg<2m", want: expression{aggregation: "avg", operator: "<", value: 120000}},
+		{kind: trend, expr: "max<500us", want: expression{aggregation: "max", operator: "<", value: 0.5}},
+		{kind: trend, expr: "med>=10ms", want: expression{aggregation: "med", operator: ">=", value: 10}},
+		{kind: rate, expr: "<0.01", want: expression{operator: "<", value: 0.01}},
+		{kind: rate, expr: "rate>0.99", want: expression{aggregation: "rate", operator: ">", value: 0.99}},
+		{kind: counter, expr: "count==0", want: expression{aggregation: "count", operator: "==", value: 0}},
+		{kind: counter, expr: "rate>100", want: expression{aggregation: "rate", operator: ">", value: 100}},
+
+		{kind: trend, expr: "<300", err: true},
+		{kind: trend, expr: "count<300", err: true},
+		{kind: trend, expr: "p(101)<300", err: true},
+		{kind: rate, expr: "avg<0.1", err: true},
+		{kind: rate, expr: "<1s", err: true},
+		{kind: counter, expr: "p(95)<3", err: true},
+		{kind: counter, expr: "<3ms", err: true},
+		{kind: counter, expr: "=3", err: true},
+		{kind: trend, expr: "p(95)<abc", err: true},
+	}
+	for _, tt := range tests {
+		e, err := parseExpression(tt.kind, tt.expr)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%q: 期望解析失败，得到 %+v", tt.expr, e)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.expr, err)
+			continue
+		}
+		if e != tt.want {
+			t.Errorf("%q = %+v，期望 %+v", tt.expr, e, tt.want)
+		}
+	}
+}
+
+// testStats 构造一组已知的统计：login 10 个请求（10ms-100ms，1 个失败），
+// search 5 个请求（全部 200ms），场景 buy 有 4 次迭代
+func testStats() *stats.Stats {
+	s := stats.NewStats(0, nil)
+	for i := 1; i <= 10; i++ {
+		r := worker.Result{APIName: "login", StatusCode: 200, Duration: time.Duration(i) * 10 * time.Millisecond,
+			Checks: []worker.CheckResult{{Name: "status", Passed: true}}}
+		if i == 10 {
+			r.Error = errors.New("boom")
+			r.Checks[0].Passed = false
+		}
+		s.AddResult(r)
+	}
+	for i := 0; i < 5; i++ {
+		s.AddResult(worker.Result{APIName: "search", Scenario: "buy", StatusCode: 200, Duration: 200 * time.Millisecond})
+	}
+	for i := 0; i < 4; i++ {
+		s.AddResult(worker.Result{Scenario: "buy", Duration: time.Second, Iteration: true})
+	}
+	s.DroppedIterations = 3
+	return s
+}
+
+func TestEvaluate(t *testing.T) {
+	s := testStats()
+	tests := []struct {
+		key    string
+		rule   string
+		passed bool
+		noData bool
+		actual string
+	}{
+		{key: "http_req_duration{api:search}", rule: "p(95)<=200ms", passed: true, actual: "200ms"},
+		{key: "http_req_duration{api:search}", rule: "avg<200", passed: false},
+		{key: "http_req_duration{api:login}", rule: "max<100ms", passed: true, actual: "90ms"},
+		{key: "http_req_duration{api:login}", rule: "min==10", passed: true},
+		{key: "iteration_duration", rule: "p(50)<2s", passed: true, actual: "1s"},
+		{key: "iteration_duration{scenario:buy}", rule: "p(50)<1s", passed: false},
+		{key: "http_req_failed", rule: "rate<0.1", passed: true, actual: "0.0667"},
+		{key: "error_rate{api:login}", rule: "<0.1", passed: false, actual: "0.1000"},
+		{key: "error_rate{scenario:buy}", rule: "==0", passed: true},
+		{key: "checks", rule: "rate>0.85", passed: true, actual: "0.9000"},
+		{key: "checks{check:status}", rule: ">0.95", passed: false},
+		{key: "http_reqs", rule: "count==15", passed: true, actual: "15"},
+		{key: "http_reqs{api:login}", rule: "count==10", passed: true},
+		{key: "http_reqs", rule: "rate>=3", passed: true, actual: "3.00/s"},
+		{key: "iterations{scenario:buy}", rule: "count==4", passed: true},
+		{key: "dropped_iterations", rule: "count==0", passed: false, actual: "3"},
+		{key: "late_iterations", rule: "count==0", passed: true},
+
+		// 没有数据的规则被跳过
+		{key: "http_req_duration{api:missing}", rule: "p(95)<1", noData: true, actual: "无数据"},
+		{key: "http_req_failed{api:missing}", rule: "rate<0.1", noData: true, actual: "无数据"},
+		{key: "http_req_duration{scenario:missing}", rule: "p(95)<1", noData: true, actual: "无数据"},
+		{key: "checks{api:search}", rule: "rate>0.9", noData: true, actual: "无数据"},
+	}
+	for _, tt := range tests {
+		result, hasData := evaluate(tt.key, config.ThresholdRule{Threshold: tt.rule}, s, 5*time.Second)
+		name := tt.key + ": " + tt.rule
+		if result.NoData != tt.noData || hasData == tt.noData {
+			t.Errorf("%s: NoData = %v，期望 %v（实际值 %s）", name, result.NoData, tt.noData, result.Actual)
+			continue
+		}
+		if !tt.noData && result.Passed != tt.passed {
+			t.Errorf("%s: Passed = %v，期望 %v（实际值 %s）", name, result.Passed, tt.passed, result.Actual)
+		}
+		if tt.actual != "" && result.Actual != tt.actual {
+			t.Errorf("%s: Actual = %q，期望 %q", name, result.Actual, tt.actual)
+		}
+	}
+}
+
+func TestFailedSkipsNoData(t *testing.T) {
+	s := testStats()
+	thresholds := map[string][]config.ThresholdRule{
+		"http_req_duration{api:missing}": {{Threshold: "p(95)<1"}},
+		"http_reqs":                      {{Threshold: "count>0"}},
+	}
+	results := Evaluate(thresholds, s, time.Second)
+	if len(results) != 2 {
+		t.Fatalf("得到 %d 条结果，期望 2 条", len(results))
+	}
+	if Failed(results) {
+		t.Errorf("没有数据的规则不应计为未通过: %+v", results)
+	}
+
+	thresholds["http_reqs"] = []config.ThresholdRule{{Threshold: "count==0"}}
+	if !Failed(Evaluate(thresholds, s, time.Second)) {
+		t.Error("未满足的规则应计为未通过")
+	}
+}
+
+func TestCheckAbort(t *testing.T) {
+	s := testStats()
+	thresholds := map[string][]config.ThresholdRule{
+		// 没有数据和没有 abortOnFail 的规则不会中止测试
+		"http_req_duration{api:missing}": {{Threshold: "p(95)<1", AbortOnFail: true}},
+		"http_reqs":                      {{Threshold: "count==0"}},
+		"error_rate":                     {{Threshold: "rate<0.01", AbortOnFail: true, DelayAbortEval: config.Duration(10 * time.Second)}},
+	}
+	if result, ok := CheckAbort(thresholds, s, 5*time.Second); ok {
+		t.Errorf("delayAbortEval 之前不应中止，得到 %+v", result)
+	}
+	result, ok := CheckAbort(thresholds, s, 10*time.Second)
+	if !ok || result.Metric != "error_rate" {
+		t.Errorf("CheckAbort = %+v, %v，期望 error_rate 未满足", result, ok)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := map[string][]config.ThresholdRule{
+		"http_req_duration{api:login}": {{Threshold: "p(95)<300ms"}},
+		"checks":                       {{Threshold: "rate>0.99"}},
+	}
+	if err := Validate(valid); err != nil {
+		t.Errorf("Validate = %v", err)
+	}
+	for key, rule := range map[string]string{
+		"iteration_duration{api:x}": "p(95)<1s",
+		"http_reqs":                 "p(95)<1",
+		"checks{check:x}":           "<1s",
+	} {
+		if err := Validate(map[string][]config.ThresholdRule{key: {{Threshold: rule}}}); err == nil {
+			t.Errorf("%s: %s 期望校验失败", key, rule)
+		}
+	}
+}
@@ -0,0 +1,386 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tyxben/goloadtest/internal/auth"
+	"github.com/tyxben/goloadtest/internal/template"
+	"github.com/tyxben/goloadtest/pkg/config"
+)
+
+const (
+	// defaultRefreshBefore 是令牌过期前提前刷新的默认时间
+	defaultRefreshBefore = 30 * time.Second
+	// defaultOAuth2TTL 是令牌响应中没有 expires_in 时 oauth2 令牌的默认有效期
+	defaultOAuth2TTL = time.Hour
+)
+
+// authProvider 是一个编译后的认证提供者
+type authProvider struct {
+	name          string
+	kind          string
+	header        string
+	scheme        string
+	perVU         bool
+	refreshBefore time.Duration
+	ttl           time.Duration
+	// shared 是所有虚拟用户共用的令牌缓存，perVU 为 true 时每个 Worker 各自缓存
+	shared auth.TokenCache
+
+	// 以下为模板，未配置的字段为 nil
+	token, username, password          *template.Template
+	tokenURL, clientID, clientSecret   *template.Template
+	scope                              *template.Template
+	params                             map[string]*template.Template
+	accessKey, secretKey, sessionToken *template.Template
+	loginURL, privateKey, message      *template.Template
+	body                               *template.JSONTemplate
+	grantType, tokenPath, region, svc  string
+	clientAuthInBody                   bool
+	baseURL                            string
+}
+
+// authProviders 缓存编译后的认证提供者，键为提供者名称。共享的令牌缓存保存在提供者中，
+// 所以每个名称只能有一个实例
+var authProviders sync.Map
+
+// CompileAuth 编译所有认证提供者，在测试开始前发现模板语法错误
+func CompileAuth(cfg *config.Config) error {
+	for name := range cfg.Auth {
+		if _, err := loadAuthProvider(cfg, name); err != nil {
+			return fmt.Errorf("认证提供者 %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func loadAuthProvider(cfg *config.Config, name string) (*authProvider, error) {
+	if p, ok := authProviders.Load(name); ok {
+		return p.(*authProvider), nil
+	}
+	p, err := compileAuthProvider(cfg, name)
+	if err != nil {
+		return nil, err
+	}
+	actual, _ := authProviders.LoadOrStore(name, p)
+	return actual.(*authProvider), nil
+}
+
+func compileAuthProvider(cfg *config.Config, name string) (*authProvider, error) {
+	a, ok := cfg.Auth[name]
+	if !ok {
+		return nil, fmt.Errorf("认证提供者 %s 不存在", name)
+	}
+
+	p := &authProvider{
+		name:             name,
+		kind:             a.Type,
+		header:           a.Header,
+		scheme:           "Bearer",
+		perVU:            a.Share == config.AuthSharePerVU || (a.Share == "" && a.Type == config.AuthWallet),
+		refreshBefore:    a.RefreshBefore.Std(),
+		ttl:              a.TTL.Std(),
+		grantType:        a.GrantType,
+		tokenPath:        a.TokenPath,
+		region:           a.Region,
+		svc:              a.Service,
+		clientAuthInBody: a.ClientAuth == "body",
+		baseURL:          cfg.BaseURL,
+	}
+	if p.header == "" {
+		p.header = cfg.TokenHeader
+	}
+	if p.header == "" {
+		p.header = "Authorization"
+	}
+	if a.Scheme != nil {
+		p.scheme = *a.Scheme
+	}
+	if p.refreshBefore == 0 {
+		p.refreshBefore = defaultRefreshBefore
+	}
+	if p.ttl == 0 && a.Type == config.AuthOAuth2 {
+		p.ttl = defaultOAuth2TTL
+	}
+	if p.grantType == "" {
+		p.grantType = "client_credentials"
+	}
+
+	var err error
+	compile := func(dst **template.Template, source string) {
+		if err != nil || source == "" {
+			return
+		}
+		*dst, err = template.Compile(source)
+	}
+	compile(&p.token, a.Token)
+	compile(&p.username, a.Username)
+	compile(&p.password, a.Password)
+	compile(&p.tokenURL, a.TokenURL)
+	compile(&p.clientID, a.ClientID)
+	compile(&p.clientSecret, a.ClientSecret)
+	compile(&p.scope, a.Scope)
+	compile(&p.accessKey, a.AccessKey)
+	compile(&p.secretKey, a.SecretKey)
+	compile(&p.sessionToken, a.SessionToken)
+	compile(&p.loginURL, a.LoginURL)
+	compile(&p.privateKey, a.PrivateKey)
+	compile(&p.message, a.Message)
+	if len(a.Params) > 0 {
+		p.params = make(map[string]*template.Template, len(a.Params))
+		for key, value := range a.Params {
+			var t *template.Template
+			compile(&t, value)
+			p.params[key] = t
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(a.Body) > 0 {
+		if p.body, err = template.CompileJSON(a.Body); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// vars 返回认证配置中的模板引用的变量名
+func (p *authProvider) vars() []string {
+	set := make(map[string]bool)
+	for _, t := range []*template.Template{
+		p.token, p.username, p.password, p.tokenURL, p.clientID, p.clientSecret, p.scope,
+		p.accessKey, p.secretKey, p.sessionToken, p.loginURL, p.privateKey, p.message,
+	} {
+		if t != nil {
+			for _, name := range t.Vars() {
+				set[name] = true
+			}
+		}
+	}
+	for _, t := range p.params {
+		for _, name := range t.Vars() {
+			set[name] = true
+		}
+	}
+	if p.body != nil {
+		for _, name := range p.body.Vars() {
+			set[name] = true
+		}
+	}
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	return names
+}
+
+// authorize 给请求添加认证信息。使用缓存的令牌时返回让该令牌失效的函数（否则为 nil），
+// 请求返回 401 时调用方应调用它
+func (w *Worker) authorize(p *authProvider, req *http.Request, body []byte, sessionData map[string]interface{}) (invalidate func(), err error) {
+	switch p.kind {
+	case config.AuthBearer:
+		token, err := renderField(p.token, sessionData)
+		if err != nil {
+			return nil, err
+		}
+		p.setToken(req, token)
+		return nil, nil
+
+	case config.AuthBasic:
+		username, err := renderField(p.username, sessionData)
+		if err != nil {
+			return nil, err
+		}
+		password, err := renderField(p.password, sessionData)
+		if err != nil {
+			return nil, err
+		}
+		req.SetBasicAuth(username, password)
+		return nil, nil
+
+	case config.AuthHMAC:
+		var creds auth.AWSCredentials
+		var err error
+		if creds.AccessKey, err = renderField(p.accessKey, sessionData); err != nil {
+			return nil, err
+		}
+		if creds.SecretKey, err = renderField(p.secretKey, sessionData); err != nil {
+			return nil, err
+		}
+		if creds.SessionToken, err = renderField(p.sessionToken, sessionData); err != nil {
+			return nil, err
+		}
+		auth.SignV4(req, body, creds, p.region, p.svc, time.Now())
+		return nil, nil
+
+	case config.AuthOAuth2, config.AuthWallet:
+		cache := &p.shared
+		if p.perVU {
+			if cache = w.tokens[p.name]; cache == nil {
+				cache = new(auth.TokenCache)
+				w.tokens[p.name] = cache
+			}
+		}
+		token, err := cache.Get(w.ctx, p.refreshBefore, func(current *auth.Token) (*auth.Token, error) {
+			if p.kind == config.AuthWallet {
+				return w.walletLogin(p, sessionData)
+			}
+			return w.fetchOAuth2Token(p, current, sessionData)
+		})
+		if err != nil {
+			return nil, err
+		}
+		p.setToken(req, token)
+		return func() { cache.Invalidate(token) }, nil
+	}
+	return nil, fmt.Errorf("不支持的认证方式 %q", p.kind)
+}
+
+func (p *authProvider) setToken(req *http.Request, token string) {
+	if p.scheme != "" {
+		token = p.scheme + " " + token
+	}
+	req.Header.Set(p.header, token)
+}
+
+// fetchOAuth2Token 获取 oauth2 令牌。当前令牌带有 refresh_token 时先尝试刷新，刷新失败再重新授权
+func (w *Worker) fetchOAuth2Token(p *authProvider, current *auth.Token, sessionData map[string]interface{}) (*auth.Token, error) {
+	tokenURL, err := renderField(p.tokenURL, sessionData)
+	if err != nil {
+		return nil, err
+	}
+	var creds auth.ClientCredentials
+	if creds.ClientID, err = renderField(p.clientID, sessionData); err != nil {
+		return nil, err
+	}
+	if creds.ClientSecret, err = renderField(p.clientSecret, sessionData); err != nil {
+		return nil, err
+	}
+	creds.InBody = p.clientAuthInBody
+
+	if current != nil && current.RefreshToken != "" {
+		form := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {current.RefreshToken}}
+		token, err := auth.FetchToken(w.ctx, w.client, tokenURL, form, creds, p.ttl)
+		if err == nil {
+			if token.RefreshToken == "" {
+				token.RefreshToken = current.RefreshToken
+			}
+			return token, nil
+		}
+		asyncLog("刷新令牌失败，重新获取: %v", err)
+	}
+
+	form := url.Values{"grant_type": {p.grantType}}
+	if p.grantType == "password" {
+		username, err := renderField(p.username, sessionData)
+		if err != nil {
+			return nil, err
+		}
+		password, err := renderField(p.password, sessionData)
+		if err != nil {
+			return nil, err
+		}
+		form.Set("username", username)
+		form.Set("password", password)
+	}
+	if scope, err := renderField(p.scope, sessionData); err != nil {
+		return nil, err
+	} else if scope != "" {
+		form.Set("scope", scope)
+	}
+	for key, t := range p.params {
+		value, err := renderField(t, sessionData)
+		if err != nil {
+			return nil, err
+		}
+		form.Set(key, value)
+	}
+	return auth.FetchToken(w.ctx, w.client, tokenURL, form, creds, p.ttl)
+}
+
+// walletLogin 用私钥签名登录消息并调用登录接口获取令牌
+func (w *Worker) walletLogin(p *authProvider, sessionData map[string]interface{}) (*auth.Token, error) {
+	privateKey, err := renderField(p.privateKey, sessionData)
+	if err != nil {
+		return nil, err
+	}
+	address, err := auth.WalletAddress(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// 登录消息和请求体可以引用 walletAddr、text 和 signature，这些变量不写入会话
+	vars := make(map[string]interface{}, len(sessionData)+3)
+	for k, v := range sessionData {
+		vars[k] = v
+	}
+	vars["walletAddr"] = address
+
+	var message string
+	if p.message != nil {
+		message, err = p.message.Render(vars)
+	} else {
+		message, err = auth.LoginMessage("")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("生成登录消息失败: %w", err)
+	}
+	signature, err := auth.PersonalSign(message, privateKey)
+	if err != nil {
+		return nil, err
+	}
+	vars["text"] = message
+	vars["signature"] = signature
+
+	var body []byte
+	if p.body != nil {
+		body, err = p.body.Render(vars)
+	} else {
+		body, err = json.Marshal(map[string]string{
+			"type":        "wallet",
+			"wallet_addr": address,
+			"text":        message,
+			"signature":   signature,
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("渲染登录请求体失败: %w", err)
+	}
+
+	loginURL, err := renderField(p.loginURL, sessionData)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.Contains(loginURL, "://") {
+		loginURL = p.baseURL + loginURL
+	}
+	token, err := auth.Login(w.ctx, w.client, loginURL, body, p.tokenPath)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &auth.Token{AccessToken: token}
+	if p.ttl > 0 {
+		t.Expiry = time.Now().Add(p.ttl)
+	}
+	return t, nil
+}
+
+// renderField 渲染认证配置中的一个字段，未配置的字段为空字符串
+func renderField(t *template.Template, sessionData map[string]interface{}) (string, error) {
+	if t == nil {
+		return "", nil
+	}
+	value, err := t.Render(sessionData)
+	if err != nil {
+		return "", fmt.Errorf("渲染认证配置失败: %w", err)
+	}
+	return value, nil
+}
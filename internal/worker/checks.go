@@ -0,0 +1,146 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+	"github.com/tyxben/goloadtest/pkg/config"
+)
+
+// CheckResult 是一项响应断言的结果
+type CheckResult struct {
+	Name   string
+	Passed bool
+}
+
+// CheckError 表示请求因断言失败而被记为失败
+type CheckError struct {
+	Failed []string
+}
+
+func (e *CheckError) Error() string {
+	return "断言失败: " + strings.Join(e.Failed, "; ")
+}
+
+// regexCache 缓存已编译的正则表达式，避免每个请求重复编译
+var regexCache sync.Map
+
+func compileRegex(pattern string) (*regexp.Regexp, error) {
+	if re, ok := regexCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	regexCache.Store(pattern, re)
+	return re, nil
+}
+
+// ValidateChecks 检查所有 API 的响应断言，在测试开始前发现无效的正则表达式
+func ValidateChecks(apis map[string]config.APIConfig) error {
+	for name, api := range apis {
+		if api.Checks == nil {
+			continue
+		}
+		for _, check := range api.Checks.JSON {
+			if check.Regex == "" {
+				continue
+			}
+			if _, err := compileRegex(check.Regex); err != nil {
+				return fmt.Errorf("API %s 的断言 json %s: 无效的正则表达式 %s: %w", name, check.Path, check.Regex, err)
+			}
+		}
+	}
+	return nil
+}
+
+// runChecks 依次执行 checks 中的断言
+func runChecks(checks *config.ChecksConfig, statusCode int, header http.Header, body []byte, duration time.Duration) []CheckResult {
+	var results []CheckResult
+	add := func(name string, passed bool) {
+		results = append(results, CheckResult{Name: name, Passed: passed})
+	}
+
+	if len(checks.Status) > 0 {
+		passed := false
+		for _, code := range checks.Status {
+			if code == statusCode {
+				passed = true
+				break
+			}
+		}
+		add(fmt.Sprintf("status in %v", checks.Status), passed)
+	}
+
+	for _, check := range checks.JSON {
+		value := gjson.GetBytes(body, check.Path)
+		if check.Exists != nil {
+			if *check.Exists {
+				add(fmt.Sprintf("json %s exists", check.Path), value.Exists())
+			} else {
+				add(fmt.Sprintf("json %s not exists", check.Path), !value.Exists())
+			}
+		}
+		if len(check.Equals) > 0 {
+			add(fmt.Sprintf("json %s == %s", check.Path, check.Equals), value.Exists() && jsonEqual(value.Raw, check.Equals))
+		}
+		if check.Regex != "" {
+			name := fmt.Sprintf("json %s =~ %s", check.Path, check.Regex)
+			re, err := compileRegex(check.Regex)
+			if err != nil {
+				asyncLog("警告: 无效的正则表达式 %s: %v", check.Regex, err)
+				add(name, false)
+				continue
+			}
+			add(name, value.Exists() && re.MatchString(value.String()))
+		}
+	}
+
+	for _, h := range checks.Headers {
+		add(fmt.Sprintf("header %s", h), header.Get(h) != "")
+	}
+
+	for _, s := range checks.BodyContains {
+		add(fmt.Sprintf("body contains %q", s), strings.Contains(string(body), s))
+	}
+
+	if checks.MaxLatency > 0 {
+		add(fmt.Sprintf("latency < %v", checks.MaxLatency.Std()), duration < checks.MaxLatency.Std())
+	}
+
+	return results
+}
+
+// jsonEqual 按 JSON 语义比较两个值，忽略格式和对象键的顺序
+func jsonEqual(a string, b []byte) bool {
+	var va, vb interface{}
+	if err := json.Unmarshal([]byte(a), &va); err != nil {
+		return false
+	}
+	if err := json.Unmarshal(b, &vb); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+// checkError 返回未通过的断言对应的错误，全部通过时返回 nil
+func checkError(results []CheckResult) error {
+	var failed []string
+	for _, r := range results {
+		if !r.Passed {
+			failed = append(failed, r.Name)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return &CheckError{Failed: failed}
+}
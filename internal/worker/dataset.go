@@ -0,0 +1,187 @@
+package worker
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/tyxben/goloadtest/internal/datasource"
+	"github.com/tyxben/goloadtest/pkg/config"
+)
+
+// Datasets 是 config.json 中声明的一组命名数据集，所有场景和虚拟用户共用。
+// 虚拟用户只从工作流引用的数据集取数，一个数据集用完只影响引用它的场景
+type Datasets struct {
+	queues map[string]*TestDataQueue
+	// perIteration 和 perRequest 是按取数时机分组并排序的数据集名称
+	perIteration []string
+	perRequest   []string
+}
+
+// OpenDatasets 打开所有命名数据集。没有声明数据集时返回 nil，nil 的 *Datasets 可以直接使用
+func OpenDatasets(defs map[string]config.Dataset) (*Datasets, error) {
+	if len(defs) == 0 {
+		return nil, nil
+	}
+
+	d := &Datasets{queues: make(map[string]*TestDataQueue, len(defs))}
+	for name, def := range defs {
+		source, err := datasource.Open(def.Source)
+		if err != nil {
+			d.Close()
+			return nil, fmt.Errorf("打开数据集 %s 失败: %w", name, err)
+		}
+		d.queues[name] = NewTestDataQueue(source, def.Policy, def.Source.RandomWindow)
+
+		if def.PerRequest() {
+			d.perRequest = append(d.perRequest, name)
+		} else {
+			d.perIteration = append(d.perIteration, name)
+		}
+	}
+	sort.Strings(d.perIteration)
+	sort.Strings(d.perRequest)
+	return d, nil
+}
+
+// Done 返回在数据集 name 按 stop 策略用完时关闭的通道
+func (d *Datasets) Done(name string) <-chan struct{} {
+	if d == nil || d.queues[name] == nil {
+		return nil
+	}
+	return d.queues[name].Done()
+}
+
+// Used 返回 cfg 的工作流和 vuSetup 引用的数据集名称（已排序），运行器只在这些数据集用完时
+// 停止该场景。工作流有错误时返回所有数据集
+func (d *Datasets) Used(cfg *config.Config) []string {
+	if d == nil {
+		return nil
+	}
+	vars, err := workflowVars(cfg)
+	var names []string
+	for _, group := range [][]string{d.perIteration, d.perRequest} {
+		for _, name := range group {
+			if err != nil || vars[name] {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// workflowVars 返回 cfg 的工作流和 vuSetup 中的请求、条件和认证配置引用的变量名
+func workflowVars(cfg *config.Config) (map[string]bool, error) {
+	workflow, err := compileWorkflow(cfg.Workflow, cfg.APIs)
+	if err != nil {
+		return nil, err
+	}
+	vuSetup, err := compileWorkflow(cfg.VUSetup, cfg.APIs)
+	if err != nil {
+		return nil, err
+	}
+	vars := make(map[string]bool)
+	if err := collectStepVars(cfg, append(workflow, vuSetup...), vars); err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
+
+func collectStepVars(cfg *config.Config, steps []*step, vars map[string]bool) error {
+	add := func(names []string) {
+		for _, name := range names {
+			vars[name] = true
+		}
+	}
+	for _, s := range steps {
+		if s.cond != nil {
+			add(s.cond.Vars())
+		}
+		if s.foreach != nil {
+			add(s.foreach.Vars())
+		}
+		if err := collectStepVars(cfg, s.children, vars); err != nil {
+			return err
+		}
+		if s.cfg.API == "" {
+			continue
+		}
+		api := cfg.APIs[s.cfg.API]
+		t, err := loadRequestTemplate(s.cfg.API, cfg.BaseURL, api)
+		if err != nil {
+			return err
+		}
+		for name := range t.vars {
+			vars[name] = true
+		}
+		if name := cfg.AuthFor(api); name != "" {
+			p, err := loadAuthProvider(cfg, name)
+			if err != nil {
+				return err
+			}
+			add(p.vars())
+		}
+	}
+	return nil
+}
+
+// Close 关闭所有数据集的数据来源
+func (d *Datasets) Close() error {
+	if d == nil {
+		return nil
+	}
+	var firstErr error
+	for _, q := range d.queues {
+		if err := q.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// drawIteration 在迭代开始时为工作流引用的按迭代取数的数据集各取一行放入会话变量，
+// 有数据集用完时返回 false
+func (w *Worker) drawIteration(sessionData map[string]interface{}) bool {
+	if w.datasets == nil {
+		return true
+	}
+	for _, name := range w.perIteration {
+		row := w.draw(name, w.datasets.queues[name])
+		if row == nil {
+			asyncLog("警告: 数据集 %s 已用完", name)
+			return false
+		}
+		sessionData[name] = row
+	}
+	return true
+}
+
+// drawRequest 在请求发送前为请求引用的按请求取数的数据集各取一行放入会话变量
+func (w *Worker) drawRequest(t *requestTemplate, sessionData map[string]interface{}) error {
+	if w.datasets == nil {
+		return nil
+	}
+	for _, name := range w.datasets.perRequest {
+		if !t.vars[name] {
+			continue
+		}
+		row := w.datasets.queues[name].Next()
+		if row == nil {
+			return fmt.Errorf("数据集 %s 已用完", name)
+		}
+		sessionData[name] = row
+	}
+	return nil
+}
+
+// draw 从 q 取一行。分发方式为 unique-per-vu 时，该虚拟用户之后一直使用第一次取到的行
+func (w *Worker) draw(key string, q *TestDataQueue) datasource.Row {
+	if row, ok := w.sticky[key]; ok {
+		return row
+	}
+	row := q.Next()
+	if row != nil && q.Sticky() {
+		w.sticky[key] = row
+	}
+	return row
+}
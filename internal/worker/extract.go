@@ -0,0 +1,267 @@
+package worker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"github.com/tyxben/goloadtest/pkg/config"
+)
+
+// ExtractError 表示从响应中提取变量失败，且该变量的 onMissing 为 fail
+type ExtractError struct {
+	Name   string
+	Reason string
+}
+
+func (e *ExtractError) Error() string {
+	return fmt.Sprintf("提取变量 %s 失败: %s", e.Name, e.Reason)
+}
+
+// ValidateExtractors 检查所有 API 的提取规则，在测试开始前发现配置错误
+func ValidateExtractors(apis map[string]config.APIConfig) error {
+	for name, api := range apis {
+		for key, e := range api.Response {
+			if err := validateExtractor(e); err != nil {
+				return fmt.Errorf("API %s 的变量 %s: %w", name, key, err)
+			}
+		}
+	}
+	return nil
+}
+
+func validateExtractor(e config.Extractor) error {
+	switch e.From {
+	case "", "body", "status":
+	case "header", "cookie":
+		if e.Path == "" {
+			return fmt.Errorf("从 %s 提取时必须指定 path", e.From)
+		}
+	default:
+		return fmt.Errorf("不支持的提取来源 %q", e.From)
+	}
+	if e.Regex != "" {
+		re, err := compileRegex(e.Regex)
+		if err != nil {
+			return fmt.Errorf("无效的正则表达式 %s: %w", e.Regex, err)
+		}
+		if e.Group != nil && (*e.Group < 0 || *e.Group > re.NumSubexp()) {
+			return fmt.Errorf("正则表达式 %s 没有第 %d 组", e.Regex, *e.Group)
+		}
+	}
+	switch e.Type {
+	case "", "string", "int", "float", "bool", "json":
+	default:
+		return fmt.Errorf("不支持的类型 %q", e.Type)
+	}
+	switch e.OnMissing {
+	case "", "fail", "warn":
+	case "default":
+		if len(e.Default) == 0 {
+			return fmt.Errorf("onMissing 为 default 时必须指定 default")
+		}
+	default:
+		return fmt.Errorf("不支持的 onMissing %q", e.OnMissing)
+	}
+	return nil
+}
+
+// extractVariables 按 extractors 从响应中提取变量存入 sessionData。
+// onMissing 为 fail 的变量提取失败时返回 *ExtractError，其余变量仍会提取
+func extractVariables(result Result, extractors map[string]config.Extractor, sessionData map[string]interface{}) error {
+	var firstErr error
+	for name, e := range extractors {
+		value, err := extract(e, result)
+		if err == nil {
+			sessionData[name] = value
+			continue
+		}
+
+		switch e.OnMissing {
+		case "warn":
+			asyncLog("警告: 提取变量 %s 失败: %v", name, err)
+		case "default":
+			var v interface{}
+			if err := decodeJSON(e.Default, &v); err != nil {
+				asyncLog("警告: 变量 %s 的默认值无效: %v", name, err)
+				continue
+			}
+			sessionData[name] = v
+		default:
+			if firstErr == nil {
+				firstErr = &ExtractError{Name: name, Reason: err.Error()}
+			}
+		}
+	}
+	return firstErr
+}
+
+func extract(e config.Extractor, result Result) (interface{}, error) {
+	var text string
+	var value interface{}
+
+	switch e.From {
+	case "header":
+		values := result.Header.Values(e.Path)
+		if len(values) == 0 {
+			return nil, fmt.Errorf("响应头 %s 不存在", e.Path)
+		}
+		text = strings.Join(values, ", ")
+		value = text
+	case "cookie":
+		found := false
+		for _, c := range (&http.Response{Header: result.Header}).Cookies() {
+			if c.Name == e.Path {
+				text, found = c.Value, true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("cookie %s 不存在", e.Path)
+		}
+		value = text
+	case "status":
+		text = strconv.Itoa(result.StatusCode)
+		value = int64(result.StatusCode)
+	default:
+		if e.Path == "" {
+			text = string(result.Response)
+			value = text
+			break
+		}
+		if !gjson.ValidBytes(result.Response) {
+			return nil, fmt.Errorf("响应不是合法的 JSON")
+		}
+		r := gjson.GetBytes(result.Response, e.Path)
+		if !r.Exists() && isPlainName(e.Path) {
+			r = findField(gjson.ParseBytes(result.Response), e.Path)
+		}
+		if !r.Exists() {
+			return nil, fmt.Errorf("响应中不存在路径 %s", e.Path)
+		}
+		text = r.String()
+		value = gjsonValue(r)
+	}
+
+	if e.Regex != "" {
+		matched, err := matchRegex(e, text)
+		if err != nil {
+			return nil, err
+		}
+		text, value = matched, matched
+	}
+
+	return convertValue(value, text, e.Type)
+}
+
+// isPlainName 返回 path 是否是不含 gjson 路径分隔符和修饰符的普通字段名
+func isPlainName(path string) bool {
+	return !strings.ContainsAny(path, ".#@|*?\\")
+}
+
+// findField 在 JSON 中按字段名递归查找，兼容旧版 response 配置：只写字段名时，
+// 根上不存在该字段则按文档顺序在嵌套对象和数组中查找，同一层的字段优先于更深层
+func findField(r gjson.Result, name string) gjson.Result {
+	if !r.IsObject() && !r.IsArray() {
+		return gjson.Result{}
+	}
+	var found gjson.Result
+	if r.IsObject() {
+		r.ForEach(func(key, value gjson.Result) bool {
+			if key.String() == name {
+				found = value
+				return false
+			}
+			return true
+		})
+		if found.Exists() {
+			return found
+		}
+	}
+	r.ForEach(func(_, value gjson.Result) bool {
+		found = findField(value, name)
+		return !found.Exists()
+	})
+	return found
+}
+
+func matchRegex(e config.Extractor, text string) (string, error) {
+	re, err := compileRegex(e.Regex)
+	if err != nil {
+		return "", err
+	}
+	match := re.FindStringSubmatch(text)
+	if match == nil {
+		return "", fmt.Errorf("正则表达式 %s 没有匹配", e.Regex)
+	}
+	group := 0
+	if e.Group != nil {
+		group = *e.Group
+	} else if len(match) > 1 {
+		group = 1
+	}
+	if group >= len(match) {
+		return "", fmt.Errorf("正则表达式 %s 没有第 %d 组", e.Regex, group)
+	}
+	return match[group], nil
+}
+
+// gjsonValue 把 gjson 结果转换为会话变量。数字保留为 json.Number 以免大整数 ID 丢失精度
+func gjsonValue(r gjson.Result) interface{} {
+	switch r.Type {
+	case gjson.Number:
+		return json.Number(r.Raw)
+	case gjson.JSON:
+		var v interface{}
+		if err := decodeJSON([]byte(r.Raw), &v); err != nil {
+			return r.Raw
+		}
+		return v
+	default:
+		return r.Value()
+	}
+}
+
+func convertValue(value interface{}, text, typ string) (interface{}, error) {
+	switch typ {
+	case "":
+		return value, nil
+	case "string":
+		return text, nil
+	case "int":
+		i, err := strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q 不是整数", text)
+		}
+		return i, nil
+	case "float":
+		f, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q 不是数字", text)
+		}
+		return f, nil
+	case "bool":
+		b, err := strconv.ParseBool(strings.TrimSpace(text))
+		if err != nil {
+			return nil, fmt.Errorf("%q 不是布尔值", text)
+		}
+		return b, nil
+	default:
+		var v interface{}
+		if err := decodeJSON([]byte(text), &v); err != nil {
+			return nil, fmt.Errorf("%q 不是合法的 JSON", text)
+		}
+		return v, nil
+	}
+}
+
+// decodeJSON 解码 JSON，数字解码为 json.Number
+func decodeJSON(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
@@ -0,0 +1,54 @@
+package worker
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/tyxben/goloadtest/pkg/config"
+)
+
+func TestExtractBodyPath(t *testing.T) {
+	result := Result{Response: json.RawMessage(`{"code":0,"data":{"user":{"id":7},"token":"abc","items":[{"sku":"a1"},{"sku":"b2"}]}}`)}
+	tests := []struct {
+		path    string
+		want    interface{}
+		missing bool
+	}{
+		{path: "data.token", want: "abc"},
+		{path: "code", want: json.Number("0")},
+		// 只写字段名时递归查找，兼容旧版配置
+		{path: "token", want: "abc"},
+		{path: "id", want: json.Number("7")},
+		{path: "sku", want: "a1"},
+		// 完整路径不递归查找
+		{path: "user.id", missing: true},
+		{path: "nothing", missing: true},
+	}
+	for _, tt := range tests {
+		value, err := extract(config.Extractor{Path: tt.path}, result)
+		if tt.missing {
+			if err == nil {
+				t.Errorf("%s: 期望提取失败，得到 %v", tt.path, value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.path, err)
+			continue
+		}
+		if value != tt.want {
+			t.Errorf("%s = %#v, want %#v", tt.path, value, tt.want)
+		}
+	}
+}
+
+func TestExtractInvalidJSON(t *testing.T) {
+	result := Result{Response: json.RawMessage("<html>ok</html>")}
+	if _, err := extract(config.Extractor{Path: "token"}, result); err == nil {
+		t.Error("从非 JSON 响应按路径提取时期望返回错误")
+	}
+	// 不指定路径时取整个响应体，不要求是 JSON
+	if v, err := extract(config.Extractor{Regex: "<html>(\\w+)"}, result); err != nil || v != "ok" {
+		t.Errorf("按正则提取 = %v, %v", v, err)
+	}
+}
@@ -0,0 +1,34 @@
+package worker
+
+import (
+	"context"
+	"log"
+
+	"github.com/tyxben/goloadtest/pkg/config"
+)
+
+// RunPhase 在测试开始前或结束后执行一次 steps（setup 或 teardown），产生的变量写入 sessionData。
+// 这些请求不计入统计，失败的请求只输出日志，返回导致 steps 结束的错误。ctx 被取消时中止进行中的请求
+func RunPhase(ctx context.Context, name string, cfg *config.Config, steps []config.Step, datasets *Datasets, sessionData map[string]interface{}) error {
+	compiled, err := compileWorkflow(steps, cfg.APIs)
+	if err != nil {
+		return err
+	}
+
+	results := make(chan Result)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for result := range results {
+			if result.Error != nil {
+				log.Printf("%s: API %s 失败: %v", name, result.APIName, result.Error)
+			}
+		}
+	}()
+
+	w := NewWorker(ctx, cfg, results, nil, datasets)
+	err = w.runSteps(compiled, sessionData)
+	close(results)
+	<-done
+	return err
+}
@@ -0,0 +1,228 @@
+package worker
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/tyxben/goloadtest/internal/auth"
+	"github.com/tyxben/goloadtest/internal/template"
+	"github.com/tyxben/goloadtest/pkg/config"
+)
+
+// requestTemplate 是一个 API 编译后的请求模板
+type requestTemplate struct {
+	url     *template.Template
+	query   map[string]*template.Template
+	headers map[string]*template.Template
+	body    *template.JSONTemplate
+	// walletKey 和 walletMessage 是 walletSign 钩子的私钥和消息模板，walletMessage 为空时生成默认登录消息
+	walletKey     *template.Template
+	walletMessage *template.Template
+	// signKey 和 signCanonical 是 signing 的私钥和待签名字符串模板，signCanonical 为空时使用默认格式
+	signKey         *template.Template
+	signCanonical   *template.Template
+	signatureHeader string
+	nonceHeader     string
+	// vars 是请求引用的变量名，用于决定发送前要从哪些按请求取数的数据集取数
+	vars map[string]bool
+}
+
+// requestTemplates 缓存每个 API 编译后的请求模板，键为 API 名称
+var requestTemplates sync.Map
+
+// CompileTemplates 编译所有 API 的请求模板，在测试开始前发现模板语法错误
+func CompileTemplates(baseURL string, apis map[string]config.APIConfig) error {
+	for name, api := range apis {
+		if _, err := loadRequestTemplate(name, baseURL, api); err != nil {
+			return fmt.Errorf("API %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func loadRequestTemplate(name, baseURL string, api config.APIConfig) (*requestTemplate, error) {
+	if t, ok := requestTemplates.Load(name); ok {
+		return t.(*requestTemplate), nil
+	}
+	t, err := compileRequestTemplate(baseURL, api)
+	if err != nil {
+		return nil, err
+	}
+	actual, _ := requestTemplates.LoadOrStore(name, t)
+	return actual.(*requestTemplate), nil
+}
+
+func compileRequestTemplate(baseURL string, api config.APIConfig) (*requestTemplate, error) {
+	t := &requestTemplate{
+		query:   make(map[string]*template.Template, len(api.QueryParams)),
+		headers: make(map[string]*template.Template, len(api.Headers)),
+	}
+
+	var err error
+	if t.url, err = template.Compile(baseURL + api.URL); err != nil {
+		return nil, err
+	}
+	for key, value := range api.QueryParams {
+		if t.query[key], err = template.Compile(value); err != nil {
+			return nil, err
+		}
+	}
+	for key, value := range api.Headers {
+		if t.headers[key], err = template.Compile(value); err != nil {
+			return nil, err
+		}
+	}
+	if body := bytes.TrimSpace(api.Body); len(body) > 0 && !bytes.Equal(body, []byte("null")) {
+		if t.body, err = template.CompileJSON(body); err != nil {
+			return nil, err
+		}
+	}
+	if ws := api.WalletSign; ws != nil {
+		if ws.PrivateKey == "" {
+			return nil, fmt.Errorf("walletSign 缺少 privateKey")
+		}
+		if t.walletKey, err = template.Compile(ws.PrivateKey); err != nil {
+			return nil, err
+		}
+		if ws.Message != "" {
+			if t.walletMessage, err = template.Compile(ws.Message); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if sg := api.Signing; sg != nil {
+		if sg.PrivateKey == "" {
+			return nil, fmt.Errorf("signing 缺少 privateKey")
+		}
+		if t.signKey, err = template.Compile(sg.PrivateKey); err != nil {
+			return nil, err
+		}
+		if sg.Canonical != "" {
+			if t.signCanonical, err = template.Compile(sg.Canonical); err != nil {
+				return nil, err
+			}
+		}
+		t.signatureHeader, t.nonceHeader = sg.SignatureHeader, sg.NonceHeader
+		if t.signatureHeader == "" {
+			t.signatureHeader = "X-Signature"
+		}
+		if t.nonceHeader == "" {
+			t.nonceHeader = "X-Nonce"
+		}
+	}
+
+	t.vars = make(map[string]bool)
+	addVars := func(names []string) {
+		for _, name := range names {
+			t.vars[name] = true
+		}
+	}
+	addVars(t.url.Vars())
+	for _, q := range t.query {
+		addVars(q.Vars())
+	}
+	for _, h := range t.headers {
+		addVars(h.Vars())
+	}
+	if t.body != nil {
+		addVars(t.body.Vars())
+	}
+	if t.walletKey != nil {
+		addVars(t.walletKey.Vars())
+	}
+	if t.walletMessage != nil {
+		addVars(t.walletMessage.Vars())
+	}
+	if t.signKey != nil {
+		addVars(t.signKey.Vars())
+	}
+	if t.signCanonical != nil {
+		addVars(t.signCanonical.Vars())
+	}
+	return t, nil
+}
+
+// renderOptional 渲染查询参数、请求头等可省略的值，引用的任一变量不存在时返回 ok 为 false，
+// 包括插值在字符串中的变量，如 "Bearer {{token}}"
+func renderOptional(t *template.Template, vars map[string]interface{}) (value string, ok bool, err error) {
+	value, err = t.RenderStrict(vars)
+	if err != nil {
+		if template.IsMissing(err) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+// signWallet 执行 walletSign 钩子，把登录消息、签名和钱包地址写入会话变量 text、signature 和 walletAddr
+func (t *requestTemplate) signWallet(sessionData map[string]interface{}) error {
+	privateKey, err := t.walletKey.Render(sessionData)
+	if err != nil {
+		return fmt.Errorf("渲染私钥失败: %w", err)
+	}
+	address, err := auth.WalletAddress(privateKey)
+	if err != nil {
+		return err
+	}
+
+	// 消息模板可以引用钱包地址，如 SIWE 消息
+	sessionData["walletAddr"] = address
+
+	var message string
+	if t.walletMessage != nil {
+		message, err = t.walletMessage.Render(sessionData)
+	} else {
+		message, err = auth.LoginMessage("")
+	}
+	if err != nil {
+		return fmt.Errorf("生成登录消息失败: %w", err)
+	}
+	signature, err := auth.PersonalSign(message, privateKey)
+	if err != nil {
+		return err
+	}
+
+	sessionData["text"] = message
+	sessionData["signature"] = signature
+	return nil
+}
+
+// signRequest 执行 signing 钩子：生成 nonce，对请求签名，把签名和 nonce 写入请求头
+func (t *requestTemplate) signRequest(req *http.Request, body []byte, sessionData map[string]interface{}) error {
+	privateKey, err := t.signKey.Render(sessionData)
+	if err != nil {
+		return fmt.Errorf("渲染私钥失败: %w", err)
+	}
+
+	nonce := auth.GenerateNonce()
+	var signature string
+	if t.signCanonical == nil {
+		signature, err = auth.SignRequest(req.Method, req.URL.String(), body, nonce, privateKey)
+	} else {
+		vars := make(map[string]interface{}, len(sessionData)+5)
+		for k, v := range sessionData {
+			vars[k] = v
+		}
+		vars["method"] = req.Method
+		vars["url"] = req.URL.String()
+		vars["path"] = req.URL.RequestURI()
+		vars["body"] = string(body)
+		vars["nonce"] = nonce
+
+		var canonical string
+		if canonical, err = t.signCanonical.Render(vars); err != nil {
+			return fmt.Errorf("渲染待签名字符串失败: %w", err)
+		}
+		signature, err = auth.SignMessage([]byte(canonical), privateKey)
+	}
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set(t.signatureHeader, signature)
+	req.Header.Set(t.nonceHeader, nonce)
+	return nil
+}
@@ -0,0 +1,72 @@
+package worker
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+
+	"github.com/tyxben/goloadtest/pkg/config"
+)
+
+// newCookieJar 创建虚拟用户的 Cookie 容器。压测的目标站点是确定的，不需要公共后缀列表
+func newCookieJar() http.CookieJar {
+	// 不传 Options 时 cookiejar.New 不会返回错误
+	jar, _ := cookiejar.New(nil)
+	return jar
+}
+
+// layeredJar 在 base 之上叠加一层 Cookie 容器：新的 Cookie 只写入上层，
+// 读取时上层的同名 Cookie 优先。cookies 为 per-iteration 时用它保留 vuSetup 中登录得到的 Cookie
+type layeredJar struct {
+	base http.CookieJar
+	http.CookieJar
+}
+
+func (j *layeredJar) Cookies(u *url.URL) []*http.Cookie {
+	cookies := j.CookieJar.Cookies(u)
+	seen := make(map[string]bool, len(cookies))
+	for _, c := range cookies {
+		seen[c.Name] = true
+	}
+	for _, c := range j.base.Cookies(u) {
+		if !seen[c.Name] {
+			cookies = append(cookies, c)
+		}
+	}
+	return cookies
+}
+
+// resetCookies 在 cookies 为 per-iteration 时为新的迭代准备空的 Cookie 容器，保留 vuSetup 的 Cookie
+func (w *Worker) resetCookies() {
+	if w.cfg.Cookies != config.CookiesPerIteration {
+		return
+	}
+	if w.setupJar != nil {
+		w.client.Jar = &layeredJar{base: w.setupJar, CookieJar: newCookieJar()}
+	} else {
+		w.client.Jar = newCookieJar()
+	}
+}
+
+// setup 执行 vuSetup，成功后把其中新产生的会话变量保存到 w.vars，之后的迭代都会带上这些变量
+func (w *Worker) setup(sessionData map[string]interface{}) error {
+	before := make(map[string]bool, len(sessionData))
+	for key := range sessionData {
+		before[key] = true
+	}
+	if err := w.runSteps(w.vuSetup, sessionData); err != nil {
+		return err
+	}
+	for key, value := range sessionData {
+		if !before[key] {
+			w.vars[key] = value
+		}
+	}
+	w.setupDone = true
+
+	if w.cfg.Cookies == config.CookiesPerIteration {
+		w.setupJar = w.client.Jar
+		w.resetCookies()
+	}
+	return nil
+}
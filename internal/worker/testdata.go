@@ -0,0 +1,158 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+
+	"github.com/tyxben/goloadtest/internal/datasource"
+	"github.com/tyxben/goloadtest/pkg/config"
+)
+
+// TestDataQueue 是一个线程安全的测试数据队列，从数据来源流式读取并按 DataPolicy 分发数据行
+type TestDataQueue struct {
+	source datasource.DataSource
+	policy config.DataPolicy
+	mutex  sync.Mutex
+
+	// window 是随机模式下的采样窗口，数据集小于 windowSize 时等于全部数据
+	window     []datasource.Row
+	windowSize int
+	// complete 表示数据集已完整读入 window，之后不再读取数据来源
+	complete bool
+
+	// done 在数据用完且策略为 stop 时关闭，通知运行器停止派发新的迭代
+	done      chan struct{}
+	closeDone *sync.Once
+}
+
+// NewTestDataQueue 创建一个从 source 读取数据的 TestDataQueue，windowSize 是随机模式的采样窗口大小。
+// source 为 nil 表示没有配置测试数据，每次迭代都得到一个空数据行
+func NewTestDataQueue(source datasource.DataSource, policy config.DataPolicy, windowSize int) *TestDataQueue {
+	if windowSize <= 0 {
+		windowSize = config.DefaultRandomWindow
+	}
+	return &TestDataQueue{
+		source:     source,
+		policy:     policy,
+		windowSize: windowSize,
+		done:       make(chan struct{}),
+		closeDone:  new(sync.Once),
+	}
+}
+
+// OpenTestDataQueue 打开 cfg 中配置的测试数据并创建队列，没有配置测试数据时队列为空
+func OpenTestDataQueue(cfg *config.Config) (*TestDataQueue, error) {
+	var source datasource.DataSource
+	if cfg.TestData.Path != "" {
+		var err error
+		source, err = datasource.Open(cfg.TestData)
+		if err != nil {
+			return nil, fmt.Errorf("打开测试数据 %s 失败: %w", cfg.TestData.Path, err)
+		}
+	}
+	return NewTestDataQueue(source, cfg.TestDataPolicy, cfg.TestData.RandomWindow), nil
+}
+
+// Next 返回下一行测试数据，数据用完且不循环时返回 nil
+func (q *TestDataQueue) Next() datasource.Row {
+	if q.source == nil {
+		return datasource.Row{}
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.policy.Mode == config.DataModeRandom {
+		return q.random()
+	}
+
+	row, err := q.source.Next()
+	if errors.Is(err, io.EOF) && q.policy.Wraps() {
+		row, err = q.rewind()
+	}
+	if err != nil {
+		if !errors.Is(err, io.EOF) {
+			asyncLog("读取测试数据失败: %v", err)
+			q.exhaust()
+		} else if q.policy.Mode != config.DataModeUniquePerVU {
+			// 每个虚拟用户独占一行时，数据不够只影响之后启动的虚拟用户
+			q.exhaust()
+		}
+		return nil
+	}
+	return row
+}
+
+// random 从采样窗口中随机取一行。数据集不超过窗口大小时是真正的均匀随机；
+// 否则是窗口抽样：每次取出的位置会被数据来源的下一行替换，读到末尾后从头继续。
+// 窗口抽样下每行在一轮中只在读入窗口后才可能被取到，不保证任意时刻在全部数据中均匀分布
+func (q *TestDataQueue) random() datasource.Row {
+	for !q.complete && len(q.window) < q.windowSize {
+		row, err := q.source.Next()
+		if errors.Is(err, io.EOF) {
+			q.complete = true
+			break
+		}
+		if err != nil {
+			asyncLog("读取测试数据失败: %v", err)
+			q.exhaust()
+			return nil
+		}
+		q.window = append(q.window, row)
+	}
+	if len(q.window) == 0 {
+		q.exhaust()
+		return nil
+	}
+
+	i := rand.Intn(len(q.window))
+	row := q.window[i]
+	if !q.complete {
+		next, err := q.source.Next()
+		if errors.Is(err, io.EOF) {
+			next, err = q.rewind()
+		}
+		if err != nil {
+			asyncLog("读取测试数据失败: %v", err)
+			q.exhaust()
+			return row
+		}
+		q.window[i] = next
+	}
+	return row
+}
+
+// rewind 回到数据来源开头并读取第一行
+func (q *TestDataQueue) rewind() (datasource.Row, error) {
+	if err := q.source.Reset(); err != nil {
+		return nil, err
+	}
+	return q.source.Next()
+}
+
+// Sticky 返回每个虚拟用户是否固定使用第一次取到的数据行
+func (q *TestDataQueue) Sticky() bool {
+	return q.policy.Mode == config.DataModeUniquePerVU
+}
+
+// Done 返回在数据用完时关闭的通道，循环使用数据的队列永远不会关闭
+func (q *TestDataQueue) Done() <-chan struct{} {
+	return q.done
+}
+
+// Close 关闭数据来源
+func (q *TestDataQueue) Close() error {
+	if q.source == nil {
+		return nil
+	}
+	return q.source.Close()
+}
+
+func (q *TestDataQueue) exhaust() {
+	q.closeDone.Do(func() {
+		close(q.done)
+	})
+}
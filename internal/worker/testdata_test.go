@@ -0,0 +1,182 @@
+package worker
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/tyxben/goloadtest/internal/datasource"
+	"github.com/tyxben/goloadtest/pkg/config"
+)
+
+// sliceSource 是内存中的数据来源，记录 Reset 的次数；err 不为 nil 时读到末尾返回 err
+type sliceSource struct {
+	rows   []datasource.Row
+	pos    int
+	resets int
+	err    error
+}
+
+func newSliceSource(n int) *sliceSource {
+	s := &sliceSource{}
+	for i := 0; i < n; i++ {
+		s.rows = append(s.rows, datasource.Row{"id": i})
+	}
+	return s
+}
+
+func (s *sliceSource) Next() (datasource.Row, error) {
+	if s.pos >= len(s.rows) {
+		if s.err != nil {
+			return nil, s.err
+		}
+		return nil, io.EOF
+	}
+	row := s.rows[s.pos]
+	s.pos++
+	return row, nil
+}
+
+func (s *sliceSource) Reset() error {
+	s.pos = 0
+	s.resets++
+	return nil
+}
+
+func (s *sliceSource) Close() error { return nil }
+
+func isDone(q *TestDataQueue) bool {
+	select {
+	case <-q.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+// TestTestDataQueueOrder 检查按顺序分发的方式取到的行和数据用完后的行为
+func TestTestDataQueueOrder(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy config.DataPolicy
+		// want 是连续取 7 次得到的 id，-1 表示得到 nil
+		want []int
+		done bool
+	}{
+		{name: "sequential", policy: config.DataPolicy{}, want: []int{0, 1, 2, -1, -1, -1, -1}, done: true},
+		{name: "circular", policy: config.DataPolicy{Mode: config.DataModeCircular}, want: []int{0, 1, 2, 0, 1, 2, 0}},
+		{name: "sequential wrap", policy: config.DataPolicy{OnExhausted: "wrap"}, want: []int{0, 1, 2, 0, 1, 2, 0}},
+		// 每个虚拟用户独占一行，数据不够时只是之后的虚拟用户取不到，不停止测试
+		{name: "unique-per-vu", policy: config.DataPolicy{Mode: config.DataModeUniquePerVU}, want: []int{0, 1, 2, -1, -1, -1, -1}},
+		{name: "unique-per-vu wrap", policy: config.DataPolicy{Mode: config.DataModeUniquePerVU, OnExhausted: "wrap"}, want: []int{0, 1, 2, 0, 1, 2, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewTestDataQueue(newSliceSource(3), tt.policy, 0)
+			for i, want := range tt.want {
+				row := q.Next()
+				got := -1
+				if row != nil {
+					got = row["id"].(int)
+				}
+				if got != want {
+					t.Errorf("第 %d 次取到 %d，期望 %d", i+1, got, want)
+				}
+			}
+			if done := isDone(q); done != tt.done {
+				t.Errorf("Done 关闭 = %v，期望 %v", done, tt.done)
+			}
+		})
+	}
+}
+
+func TestTestDataQueueReadError(t *testing.T) {
+	source := newSliceSource(1)
+	source.err = errors.New("broken")
+	q := NewTestDataQueue(source, config.DataPolicy{Mode: config.DataModeCircular}, 0)
+	if q.Next() == nil {
+		t.Fatal("第一行应该能取到")
+	}
+	if row := q.Next(); row != nil {
+		t.Errorf("读取失败后取到 %v", row)
+	}
+	if !isDone(q) {
+		t.Error("读取失败后应关闭 Done，即使策略是循环使用")
+	}
+}
+
+// TestTestDataQueueRandomSmall 检查数据不超过窗口时全部读入内存、只读一遍且每行都能取到
+func TestTestDataQueueRandomSmall(t *testing.T) {
+	source := newSliceSource(5)
+	q := NewTestDataQueue(source, config.DataPolicy{Mode: config.DataModeRandom}, 10)
+	seen := make(map[int]int)
+	for i := 0; i < 500; i++ {
+		row := q.Next()
+		if row == nil {
+			t.Fatal("random 不应取到 nil")
+		}
+		seen[row["id"].(int)]++
+	}
+	if len(seen) != 5 {
+		t.Errorf("取到的行 %v，期望覆盖全部 5 行", seen)
+	}
+	if source.resets != 0 {
+		t.Errorf("数据已全部读入内存，不应 Reset，实际 Reset %d 次", source.resets)
+	}
+	if isDone(q) {
+		t.Error("random 不应关闭 Done")
+	}
+}
+
+// TestTestDataQueueRandomWindow 检查数据超过窗口时的窗口抽样：
+// 取出的行由下一行替换，读到末尾后从头继续，长期看每行都能取到
+func TestTestDataQueueRandomWindow(t *testing.T) {
+	source := newSliceSource(20)
+	q := NewTestDataQueue(source, config.DataPolicy{Mode: config.DataModeRandom}, 4)
+
+	// 前 4 次取数时窗口里只有前 8 行中的行
+	for i := 0; i < 4; i++ {
+		if id := q.Next()["id"].(int); id >= 8 {
+			t.Errorf("第 %d 次取到第 %d 行，窗口抽样下还不应读到这一行", i+1, id)
+		}
+	}
+	if len(q.window) != 4 {
+		t.Errorf("窗口大小 %d，期望 4", len(q.window))
+	}
+
+	seen := make(map[int]bool)
+	for i := 0; i < 200; i++ {
+		seen[q.Next()["id"].(int)] = true
+	}
+	if len(seen) != 20 {
+		t.Errorf("取到 %d 个不同的行，期望覆盖全部 20 行", len(seen))
+	}
+	if source.resets == 0 {
+		t.Error("数据读到末尾后应从头继续")
+	}
+	if isDone(q) {
+		t.Error("random 不应关闭 Done")
+	}
+}
+
+func TestTestDataQueueRandomEmpty(t *testing.T) {
+	q := NewTestDataQueue(newSliceSource(0), config.DataPolicy{Mode: config.DataModeRandom}, 0)
+	if row := q.Next(); row != nil {
+		t.Errorf("空数据集取到 %v", row)
+	}
+	if !isDone(q) {
+		t.Error("空数据集应关闭 Done")
+	}
+}
+
+func TestTestDataQueueNoSource(t *testing.T) {
+	q := NewTestDataQueue(nil, config.DataPolicy{}, 0)
+	for i := 0; i < 3; i++ {
+		if row := q.Next(); row == nil || len(row) != 0 {
+			t.Errorf("没有测试数据时应得到空数据行，实际 %v", row)
+		}
+	}
+	if isDone(q) {
+		t.Error("没有测试数据时不应关闭 Done")
+	}
+}
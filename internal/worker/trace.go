@@ -0,0 +1,99 @@
+package worker
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timing 是一个请求各阶段的耗时。复用连接的请求没有 DNS、TCP 连接和 TLS 握手阶段，这些阶段为 0
+type Timing struct {
+	// DNS 是域名解析时间
+	DNS time.Duration
+	// Connect 是建立 TCP 连接的时间
+	Connect time.Duration
+	// TLS 是 TLS 握手时间
+	TLS time.Duration
+	// TTFB 是请求发送完成到收到响应第一个字节的时间，主要是服务端的处理时间
+	TTFB time.Duration
+	// Transfer 是从收到第一个字节到读完响应体的时间
+	Transfer time.Duration
+	// Reused 为 true 表示请求复用了连接池中的连接
+	Reused bool
+}
+
+// tracer 通过 httptrace 记录请求各阶段的时间点。连接池可能在请求返回后才完成后台拨号，
+// 回调会在其他协程中执行，所以用互斥锁保护
+type tracer struct {
+	mutex        sync.Mutex
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+	reused       bool
+}
+
+func (t *tracer) clientTrace() *httptrace.ClientTrace {
+	mark := func(field *time.Time) {
+		t.mutex.Lock()
+		// 只记录第一次，双栈拨号时会有多次连接
+		if field.IsZero() {
+			*field = time.Now()
+		}
+		t.mutex.Unlock()
+	}
+	return &httptrace.ClientTrace{
+		DNSStart:     func(httptrace.DNSStartInfo) { mark(&t.dnsStart) },
+		DNSDone:      func(httptrace.DNSDoneInfo) { mark(&t.dnsDone) },
+		ConnectStart: func(string, string) { mark(&t.connectStart) },
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				mark(&t.connectDone)
+			}
+		},
+		TLSHandshakeStart: func() { mark(&t.tlsStart) },
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			if err == nil {
+				mark(&t.tlsDone)
+			}
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mutex.Lock()
+			t.reused = info.Reused
+			t.mutex.Unlock()
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { mark(&t.wroteRequest) },
+		GotFirstResponseByte: func() { mark(&t.firstByte) },
+	}
+}
+
+// timing 在读完响应体（done）后计算各阶段耗时
+func (t *tracer) timing(done time.Time) Timing {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	timing := Timing{
+		Reused:   t.reused,
+		TTFB:     between(t.wroteRequest, t.firstByte),
+		Transfer: between(t.firstByte, done),
+	}
+	if !t.reused {
+		timing.DNS = between(t.dnsStart, t.dnsDone)
+		timing.Connect = between(t.connectStart, t.connectDone)
+		timing.TLS = between(t.tlsStart, t.tlsDone)
+	}
+	return timing
+}
+
+// between 返回 start 到 end 的时间，任一时间点缺失时为 0
+func between(start, end time.Time) time.Duration {
+	if start.IsZero() || end.IsZero() || end.Before(start) {
+		return 0
+	}
+	return end.Sub(start)
+}
@@ -0,0 +1,147 @@
+package worker
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/tyxben/goloadtest/pkg/config"
+	"golang.org/x/net/http2"
+)
+
+// transports 缓存按连接配置创建的 Transport，键为 config.TransportConfig，值为 *transportEntry
+var transports sync.Map
+
+type transportEntry struct {
+	once      sync.Once
+	transport http.RoundTripper
+	err       error
+}
+
+// ConfigureTransport 按配置创建虚拟用户共用的 Transport，在测试开始前发现证书等配置错误
+func ConfigureTransport(cfg config.TransportConfig) error {
+	_, err := loadTransport(cfg)
+	return err
+}
+
+// loadTransport 返回按 cfg 创建的 Transport，相同的配置只创建一次。
+// 使用同一配置的所有虚拟用户共用一个 Transport，使连接池的上限对整个测试生效
+func loadTransport(cfg config.TransportConfig) (http.RoundTripper, error) {
+	// 请求超时由 http.Client 处理，不影响 Transport
+	key := cfg
+	key.Timeout = 0
+	v, _ := transports.LoadOrStore(key, new(transportEntry))
+	entry := v.(*transportEntry)
+	entry.once.Do(func() {
+		entry.transport, entry.err = newTransport(cfg)
+	})
+	return entry.transport, entry.err
+}
+
+func newTransport(cfg config.TransportConfig) (http.RoundTripper, error) {
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
+	t := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsConfig,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		DisableKeepAlives:     cfg.DisableKeepAlives,
+	}
+	if cfg.MaxIdleConns > 0 {
+		t.MaxIdleConns = cfg.MaxIdleConns
+	}
+	if cfg.IdleConnTimeout > 0 {
+		t.IdleConnTimeout = cfg.IdleConnTimeout.Std()
+	}
+	if cfg.Proxy != "" {
+		proxyURL, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("解析代理地址失败: %w", err)
+		}
+		t.Proxy = http.ProxyURL(proxyURL)
+	}
+	if cfg.Protocol == config.ProtocolHTTP1 {
+		// TLSNextProto 为非 nil 的空表时不会协商 HTTP/2
+		t.ForceAttemptHTTP2 = false
+		t.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+	if cfg.Protocol == config.ProtocolH2C {
+		// h2c 直接在 TCP 连接上使用 HTTP/2，一个连接上复用所有请求
+		return &h2cTransport{
+			h2c: &http2.Transport{
+				AllowHTTP: true,
+				DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+					return dialer.DialContext(ctx, network, addr)
+				},
+				IdleConnTimeout: t.IdleConnTimeout,
+			},
+			https: t,
+		}, nil
+	}
+	return t, nil
+}
+
+// h2cTransport 对 http 请求使用 h2c，对 https 请求（如绝对地址的 API、oauth2 的 tokenURL）
+// 仍然使用 TLS，避免对 TLS 端口发送明文
+type h2cTransport struct {
+	h2c   *http2.Transport
+	https http.RoundTripper
+}
+
+func (t *h2cTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "http" {
+		return t.h2c.RoundTrip(req)
+	}
+	return t.https.RoundTrip(req)
+}
+
+// newTLSConfig 按配置加载 CA 证书和客户端证书
+func newTLSConfig(cfg config.TransportConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+		ServerName:         cfg.ServerName,
+	}
+	if cfg.CACert != "" {
+		pem, err := os.ReadFile(cfg.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("读取 CA 证书失败: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA 证书 %s 中没有合法的 PEM 证书", cfg.CACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCert, cfg.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("加载客户端证书失败: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
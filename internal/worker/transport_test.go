@@ -0,0 +1,228 @@
+package worker
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tyxben/goloadtest/pkg/config"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// protoHandler 在响应体中返回请求使用的协议
+var protoHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	io.WriteString(w, r.Proto)
+})
+
+func get(t *testing.T, rt http.RoundTripper, url string) (string, error) {
+	t.Helper()
+	client := &http.Client{Transport: rt, Timeout: 5 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return string(body), err
+}
+
+func TestLoadTransportPerConfig(t *testing.T) {
+	a, err := loadTransport(config.TransportConfig{MaxIdleConnsPerHost: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	same, _ := loadTransport(config.TransportConfig{MaxIdleConnsPerHost: 7, Timeout: config.Duration(time.Second)})
+	if same != a {
+		t.Error("只有超时不同的配置应共用同一个 Transport")
+	}
+	other, _ := loadTransport(config.TransportConfig{MaxIdleConnsPerHost: 8})
+	if other == a {
+		t.Error("不同的配置不应共用 Transport")
+	}
+	if a.(*http.Transport).MaxIdleConnsPerHost != 7 || other.(*http.Transport).MaxIdleConnsPerHost != 8 {
+		t.Error("Transport 没有按各自的配置创建")
+	}
+
+	if _, err := loadTransport(config.TransportConfig{Proxy: "://bad"}); err == nil {
+		t.Error("无效的代理地址应返回错误")
+	}
+}
+
+func TestTransportProtocol(t *testing.T) {
+	tls2 := httptest.NewUnstartedServer(protoHandler)
+	tls2.EnableHTTP2 = true
+	tls2.StartTLS()
+	defer tls2.Close()
+	caCert := writePEM(t, "ca.pem", "CERTIFICATE", tls2.Certificate().Raw)
+
+	plain := httptest.NewServer(h2c.NewHandler(protoHandler, &http2.Server{}))
+	defer plain.Close()
+
+	tests := []struct {
+		name string
+		cfg  config.TransportConfig
+		url  string
+		want string
+	}{
+		{name: "自动协商", cfg: config.TransportConfig{CACert: caCert}, url: tls2.URL, want: "HTTP/2.0"},
+		{name: "http1", cfg: config.TransportConfig{CACert: caCert, Protocol: config.ProtocolHTTP1}, url: tls2.URL, want: "HTTP/1.1"},
+		{name: "h2c", cfg: config.TransportConfig{Protocol: config.ProtocolH2C}, url: plain.URL, want: "HTTP/2.0"},
+		// h2c 的 Transport 对 https 请求仍然使用 TLS
+		{name: "h2c https", cfg: config.TransportConfig{CACert: caCert, Protocol: config.ProtocolH2C}, url: tls2.URL, want: "HTTP/2.0"},
+		{name: "明文 http", cfg: config.TransportConfig{}, url: plain.URL, want: "HTTP/1.1"},
+	}
+	for _, tt := range tests {
+		rt, err := newTransport(tt.cfg)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		got, err := get(t, rt, tt.url)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: 协议 %s，期望 %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTransportMTLS(t *testing.T) {
+	dir := t.TempDir()
+	clientCert, clientKey, clientDER := newClientCert(t, dir)
+	pool := x509.NewCertPool()
+	cert, _ := x509.ParseCertificate(clientDER)
+	pool.AddCert(cert)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	// 下面故意让握手失败，不输出服务端的握手错误日志
+	ts.Config.ErrorLog = log.New(io.Discard, "", 0)
+	ts.StartTLS()
+	defer ts.Close()
+	caCert := writePEM(t, "server-ca.pem", "CERTIFICATE", ts.Certificate().Raw)
+
+	rt, err := newTransport(config.TransportConfig{CACert: caCert, ClientCert: clientCert, ClientKey: clientKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := get(t, rt, ts.URL); err != nil || got != "loadtest-client" {
+		t.Errorf("带客户端证书的请求 = %q, %v", got, err)
+	}
+
+	rt, err = newTransport(config.TransportConfig{CACert: caCert})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := get(t, rt, ts.URL); err == nil {
+		t.Error("没有客户端证书时服务端应拒绝握手")
+	}
+
+	// 不信任服务端证书时握手失败
+	rt, _ = newTransport(config.TransportConfig{ClientCert: clientCert, ClientKey: clientKey})
+	if _, err := get(t, rt, ts.URL); err == nil {
+		t.Error("没有配置 CA 证书时应校验失败")
+	}
+}
+
+func TestTransportProxy(t *testing.T) {
+	proxied := make(chan string, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 经过代理的请求行是绝对地址
+		proxied <- r.RequestURI
+		io.WriteString(w, "proxied")
+	}))
+	defer proxy.Close()
+
+	rt, err := newTransport(config.TransportConfig{Proxy: proxy.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := get(t, rt, "http://backend.invalid/path?q=1")
+	if err != nil || got != "proxied" {
+		t.Fatalf("经代理的请求 = %q, %v", got, err)
+	}
+	if uri := <-proxied; uri != "http://backend.invalid/path?q=1" {
+		t.Errorf("代理收到的请求地址 %q", uri)
+	}
+}
+
+func TestTransportConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for name, cfg := range map[string]config.TransportConfig{
+		"CA 证书不存在":    {CACert: filepath.Join(dir, "missing.pem")},
+		"CA 证书不是 PEM": {CACert: notPEM},
+		"客户端证书不存在":    {ClientCert: filepath.Join(dir, "missing.pem"), ClientKey: filepath.Join(dir, "missing.key")},
+		"代理地址无效":      {Proxy: "://bad"},
+	} {
+		if _, err := newTransport(cfg); err == nil {
+			t.Errorf("%s: 期望返回错误", name)
+		}
+	}
+}
+
+func writePEM(t *testing.T, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newClientCert 生成自签名的客户端证书，返回证书和私钥文件路径以及证书的 DER 编码
+func newClientCert(t *testing.T, dir string) (certFile, keyFile string, der []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "loadtest-client"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err = x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile = filepath.Join(dir, "client.pem")
+	keyFile = filepath.Join(dir, "client.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile, der
+}
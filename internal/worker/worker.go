@@ -2,84 +2,202 @@ package worker
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
 	"os"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/tidwall/gjson"
+	"github.com/tyxben/goloadtest/internal/auth"
+	"github.com/tyxben/goloadtest/internal/datasource"
 	"github.com/tyxben/goloadtest/pkg/config"
 )
 
 type Result struct {
-	APIName    string
+	APIName string
+	// Scenario 是产生该结果的场景名，未配置场景时为空
+	Scenario   string
 	StatusCode int
 	Duration   time.Duration
 	Error      error
 	Response   json.RawMessage
+	// Header 是响应头，用于提取变量
+	Header http.Header
+	// Checks 是对响应执行的断言结果
+	Checks []CheckResult
+	// Timing 是请求各阶段的耗时，只有收到响应的请求才有
+	Timing *Timing
+	// Iteration 为 true 表示这是一次完整工作流迭代的汇总结果（从第一步开始到最后一步结束），
+	// 而不是单个请求；Error 为迭代中遇到的第一个错误
+	Iteration bool
 }
 
-// TestDataQueue 是一个线程安全的队列，用于存储测试数据
-type TestDataQueue struct {
-	data  []map[string]string
-	mutex sync.Mutex
+// Worker 代表一个虚拟用户，持有独立的 HTTP 客户端，逐次执行工作流迭代
+type Worker struct {
+	// ctx 被取消时进行中的请求立即中止，Worker 不再开始新的迭代
+	ctx           context.Context
+	cfg           *config.Config
+	client        *http.Client
+	results       chan<- Result
+	testDataQueue *TestDataQueue
+	datasets      *Datasets
+	workflow      []*step
+	vuSetup       []*step
+	workflowErr   error
+	// setupDone 为 true 表示 vuSetup 已经成功执行
+	setupDone bool
+	// vars 是在迭代之间保留的会话变量：vuSetup 中新产生的变量和 persist 指定的变量
+	vars map[string]interface{}
+	// setupJar 是 cookies 为 per-iteration 时 vuSetup 得到的 Cookie，每次迭代都会带上
+	setupJar http.CookieJar
+	// sticky 是分发方式为 unique-per-vu 时该虚拟用户固定使用的数据行，
+	// 键为数据集名称，全局测试数据的键为空字符串
+	sticky map[string]datasource.Row
+	// tokens 是 share 为 per-vu 的认证提供者为该虚拟用户缓存的令牌，键为提供者名称
+	tokens map[string]*auth.TokenCache
+	// perIteration 是该虚拟用户每次迭代开始时取数的数据集，只包含工作流引用的按迭代取数的数据集
+	perIteration []string
 }
 
-// NewTestDataQueue 创建一个新的 TestDataQueue 并预加载所有数据
-func NewTestDataQueue(testData []map[string]string) *TestDataQueue {
-	return &TestDataQueue{
-		data: testData,
+// NewWorker 创建一个新的 Worker，ctx 被取消时中止进行中的请求
+func NewWorker(ctx context.Context, cfg *config.Config, results chan<- Result, testDataQueue *TestDataQueue, datasets *Datasets) *Worker {
+	workflow, err := compileWorkflow(cfg.Workflow, cfg.APIs)
+	vuSetup, setupErr := compileWorkflow(cfg.VUSetup, cfg.APIs)
+	if err == nil && setupErr != nil {
+		err = fmt.Errorf("vuSetup: %w", setupErr)
 	}
+	transport, transportErr := loadTransport(cfg.Transport)
+	if err == nil && transportErr != nil {
+		err = transportErr
+	}
+	w := &Worker{
+		ctx: ctx,
+		cfg: cfg,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   cfg.Transport.RequestTimeout(),
+		},
+		results:       results,
+		testDataQueue: testDataQueue,
+		datasets:      datasets,
+		workflow:      workflow,
+		vuSetup:       vuSetup,
+		workflowErr:   err,
+		setupDone:     len(vuSetup) == 0,
+		vars:          make(map[string]interface{}),
+		sticky:        make(map[string]datasource.Row),
+		tokens:        make(map[string]*auth.TokenCache),
+	}
+	if cfg.Cookies == config.CookiesPerVU || cfg.Cookies == config.CookiesPerIteration {
+		w.client.Jar = newCookieJar()
+	}
+	if datasets != nil {
+		used := make(map[string]bool)
+		for _, name := range datasets.Used(cfg) {
+			used[name] = true
+		}
+		for _, name := range datasets.perIteration {
+			if used[name] {
+				w.perIteration = append(w.perIteration, name)
+			}
+		}
+	}
+	return w
 }
 
-// Next 返回队列中的下一个测试数据，如果队列为空则返回 nil
-func (q *TestDataQueue) Next() map[string]string {
-	q.mutex.Lock()
-	defer q.mutex.Unlock()
-
-	if len(q.data) == 0 {
-		return nil
+// Run 为 tasks 中的每个任务执行一次工作流迭代，直到通道关闭、测试数据用完或 ctx 被取消。
+// ctx 被取消后不再开始新的迭代，即使 tasks 中还有缓冲的任务；work 被取消时中止进行中的请求
+func Run(ctx, work context.Context, cfg *config.Config, tasks <-chan struct{}, results chan<- Result, testDataQueue *TestDataQueue, datasets *Datasets) {
+	w := NewWorker(work, cfg, results, testDataQueue, datasets)
+	for {
+		select {
+		case _, ok := <-tasks:
+			// ctx 和 tasks 同时就绪时 select 可能选中 tasks
+			if !ok || ctx.Err() != nil || !w.Iterate() {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
 	}
-
-	item := q.data[0]
-	q.data = q.data[1:]
-	return item
 }
 
-func Run(cfg *config.Config, tasks <-chan struct{}, results chan<- Result, testDataQueue *TestDataQueue) {
-	client := &http.Client{
-		Timeout: time.Second * 10,
+// Iterate 执行一次完整的工作流，测试数据或按迭代取数的数据集用完、或 ctx 被取消时返回 false
+func (w *Worker) Iterate() bool {
+	if w.ctx.Err() != nil {
+		return false
 	}
+	if w.workflowErr != nil {
+		asyncLog("工作流配置错误: %v", w.workflowErr)
+		return false
+	}
+	w.resetCookies()
 
-	for range tasks {
-		sessionData := make(map[string]interface{})
-		testData := testDataQueue.Next()
-		if testData == nil {
-			asyncLog("警告: 所有测试数据已用完")
-			break
-		}
-		for key, value := range testData {
-			sessionData[key] = value
-		}
-
-		for _, apiName := range cfg.Workflow {
-			apiConfig := cfg.APIs[apiName]
-			result := callAPI(client, cfg.BaseURL+apiConfig.URL, apiConfig, sessionData)
-			result.APIName = apiName
-			results <- result
+	// setup 产生的变量和保留的变量放在最前面，本次迭代取到的测试数据可以覆盖它们。
+	// 每次迭代都从 Globals 复制，所以虚拟用户对这些变量的修改不会影响其他虚拟用户
+	sessionData := make(map[string]interface{}, len(w.cfg.Globals)+len(w.vars))
+	for key, value := range w.cfg.Globals {
+		sessionData[key] = value
+	}
+	for key, value := range w.vars {
+		sessionData[key] = value
+	}
+	testData := w.draw("", w.testDataQueue)
+	if testData == nil {
+		asyncLog("警告: 所有测试数据已用完")
+		return false
+	}
+	for key, value := range testData {
+		sessionData[key] = value
+	}
+	if !w.drawIteration(sessionData) {
+		return false
+	}
 
-			if result.Error != nil {
-				break
+	if !w.setupDone {
+		start := time.Now()
+		if err := w.setup(sessionData); err != nil {
+			if w.ctx.Err() != nil {
+				return false
+			}
+			// 初始化失败计为一次失败的迭代，下一次迭代重新执行 vuSetup
+			asyncLog("虚拟用户初始化失败: %v", err)
+			w.results <- Result{
+				Scenario:  w.cfg.Scenario,
+				Duration:  time.Since(start),
+				Error:     err,
+				Iteration: true,
 			}
+			return true
+		}
+	}
 
-			handleResponse(result.Response, apiConfig.Response, sessionData)
+	start := time.Now()
+	iterationErr := w.runSteps(w.workflow, sessionData)
+	if w.ctx.Err() != nil {
+		// 被强制中止的迭代不完整，不计入统计
+		return false
+	}
+	for _, name := range w.cfg.Persist {
+		if value, ok := sessionData[name]; ok {
+			w.vars[name] = value
 		}
 	}
+	w.results <- Result{
+		Scenario:  w.cfg.Scenario,
+		Duration:  time.Since(start),
+		Error:     iterationErr,
+		Iteration: true,
+	}
+	return true
 }
 
 // 检查 API 是否需要测试数据
@@ -92,149 +210,163 @@ func needsTestData(apiConfig config.APIConfig) bool {
 	return false
 }
 
-func callAPI(client *http.Client, apiUrl string, apiConfig config.APIConfig, sessionData map[string]interface{}) Result {
-	start := time.Now()
+func (w *Worker) callAPI(apiName string, apiConfig config.APIConfig, sessionData map[string]interface{}) Result {
+	tmpl, err := loadRequestTemplate(apiName, w.cfg.BaseURL, apiConfig)
+	if err != nil {
+		asyncLog("编译请求模板失败: %v", err)
+		return Result{Error: err}
+	}
 
-	// 准备查询参数
-	if len(apiConfig.QueryParams) > 0 {
+	if tmpl.walletKey != nil {
+		if err := tmpl.signWallet(sessionData); err != nil {
+			asyncLog("钱包签名失败: %v", err)
+			return Result{Error: err}
+		}
+	}
+
+	apiUrl, err := tmpl.url.Render(sessionData)
+	if err != nil {
+		asyncLog("渲染请求地址失败: %v", err)
+		return Result{Error: err}
+	}
+
+	// 准备查询参数，引用的变量不存在时省略该参数
+	if len(tmpl.query) > 0 {
 		queryParams := make(url.Values)
-		for key, value := range apiConfig.QueryParams {
-			if strings.HasPrefix(value, "{{") && strings.HasSuffix(value, "}}") {
-				paramName := strings.Trim(value, "{}")
-				if paramValue, ok := sessionData[paramName]; ok {
-					queryParams.Set(key, fmt.Sprintf("%v", paramValue))
-				}
-			} else {
+		for key, t := range tmpl.query {
+			value, ok, err := renderOptional(t, sessionData)
+			if err != nil {
+				asyncLog("渲染查询参数 %s 失败: %v", key, err)
+				return Result{Error: err}
+			}
+			if ok {
 				queryParams.Set(key, value)
 			}
-
 		}
 		apiUrl += "?" + queryParams.Encode()
 	}
 
 	// 准备请求体
 	var body []byte
-	if len(apiConfig.Body) > 0 {
-		bodyMap := make(map[string]interface{})
-		for key, value := range apiConfig.Body {
-			if strings.HasPrefix(value, "{{") && strings.HasSuffix(value, "}}") {
-				paramName := strings.Trim(value, "{}")
-				if paramValue, ok := sessionData[paramName]; ok {
-					bodyMap[key] = paramValue
-				}
-			} else {
-				bodyMap[key] = value
-			}
+	if tmpl.body != nil {
+		body, err = tmpl.body.Render(sessionData)
+		if err != nil {
+			asyncLog("渲染请求体失败: %v", err)
+			return Result{Error: err}
 		}
-		body, _ = json.Marshal(bodyMap)
 	}
 
-	req, err := http.NewRequest(apiConfig.Method, apiUrl, bytes.NewReader(body))
+	req, err := http.NewRequestWithContext(w.ctx, apiConfig.Method, apiUrl, bytes.NewReader(body))
 	if err != nil {
 		asyncLog("创建请求失败: %v", err)
 		return Result{Error: err}
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	// 设置请求头
-	for k, v := range apiConfig.Headers {
-		req.Header.Set(k, replaceSessionData(v, sessionData))
+	// 设置请求头，引用的变量不存在时省略该请求头
+	for k, t := range tmpl.headers {
+		value, ok, err := renderOptional(t, sessionData)
+		if err != nil {
+			asyncLog("渲染请求头 %s 失败: %v", k, err)
+			return Result{Error: err}
+		}
+		if ok {
+			req.Header.Set(k, value)
+		}
+	}
+
+	// 认证在自定义请求头之后，覆盖同名请求头
+	var invalidateToken func()
+	if name := w.cfg.AuthFor(apiConfig); name != "" {
+		provider, err := loadAuthProvider(w.cfg, name)
+		if err == nil {
+			invalidateToken, err = w.authorize(provider, req, body, sessionData)
+		}
+		if err != nil {
+			asyncLog("认证失败: %v", err)
+			return Result{Error: err}
+		}
 	}
 
+	// 获取令牌（oauth2 或钱包登录）的时间不计入该 API 的响应时间
+	start := time.Now()
+
+	// 签名放在最后，待签名字符串使用最终的地址和请求体
+	if tmpl.signKey != nil {
+		if err := tmpl.signRequest(req, body, sessionData); err != nil {
+			asyncLog("请求签名失败: %v", err)
+			return Result{Error: err}
+		}
+	}
+
+	client := w.client
+	if apiConfig.Timeout > 0 {
+		// 复制客户端只修改超时时间，连接池和 Cookie 仍然共用
+		c := *w.client
+		c.Timeout = apiConfig.Timeout.Std()
+		client = &c
+	}
+	var trace tracer
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace.clientTrace()))
 	resp, err := client.Do(req)
 	if err != nil {
-		asyncLog("发送请求失败: %v", err)
+		// 被强制中止的请求不是目标服务的错误，不输出日志
+		if w.ctx.Err() == nil {
+			asyncLog("发送请求失败: %v", err)
+		}
 		return Result{Error: err}
 	}
 	defer resp.Body.Close()
 
 	responseBody, _ := ioutil.ReadAll(resp.Body)
 	duration := time.Since(start)
-	//check if responseBody 包含code 且非 0 输出
-	var responseMap map[string]interface{}
-	err = json.Unmarshal(responseBody, &responseMap)
-	if err != nil {
-		asyncLog("警告: 无法解析响应 JSON: %v", err)
-		return Result{Error: err}
-	}
-	if code, ok := responseMap["code"]; ok {
-		// 将 code 转换为整数进行比较
-		codeInt, isInt := code.(float64)
-		if isInt && int(codeInt) != 0 {
-			if walletAddr, ok := sessionData["walletAddr"]; ok {
-				asyncLog("响应包含错误码: %v, 地址: %v", int(codeInt), walletAddr)
-			}
-		}
+	timing := trace.timing(time.Now())
+
+	// 令牌被拒绝时丢弃缓存，下一个请求重新获取。其他协程正在获取令牌时这里会等待，
+	// 所以放在计时结束之后
+	if resp.StatusCode == http.StatusUnauthorized && invalidateToken != nil {
+		invalidateToken()
 	}
-	asyncLog("地址%s,响应: %v", sessionData["walletAddr"], string(responseBody))
-	return Result{
+
+	result := Result{
 		StatusCode: resp.StatusCode,
 		Duration:   duration,
 		Response:   responseBody,
+		Header:     resp.Header,
+		Timing:     &timing,
 	}
-}
-
-func handleResponse(response json.RawMessage, responseConfig map[string]string, sessionData map[string]interface{}) {
-
-	// 解析整个 JSON 响应
-	var responseMap map[string]interface{}
-	err := json.Unmarshal(response, &responseMap)
-	if err != nil {
-		asyncLog("警告: 无法解析响应 JSON: %v", err)
-		return
-	}
-
-	// 处理 responseConfig 中指定的所有字段
-	for key, fieldName := range responseConfig {
-		value := findFieldRecursively(responseMap, fieldName)
-		if value != nil {
-			sessionData[key] = value
-		} else {
-			asyncLog("警告: %s 在响应中未找到字段 %s", response, fieldName)
 
+	// 配置了断言时由断言决定请求是否成功。响应体可以不是 JSON（如 HTML 页面或 204 空响应），
+	// 只有按路径提取响应变量时才解析 JSON，解析失败按该变量的 onMissing 处理
+	if apiConfig.Checks != nil {
+		result.Checks = runChecks(apiConfig.Checks, resp.StatusCode, resp.Header, responseBody, duration)
+		if err := checkError(result.Checks); err != nil && !apiConfig.Checks.RecordOnly {
+			asyncLog("地址%s,%v", sessionData["walletAddr"], err)
+			result.Error = err
+			return result
 		}
 	}
-}
 
-// 递归查找指定字段名的值
-func findFieldRecursively(data interface{}, fieldName string) interface{} {
-	switch v := data.(type) {
-	case map[string]interface{}:
-		for key, value := range v {
-			if key == fieldName {
-				return value
-			}
-			if result := findFieldRecursively(value, fieldName); result != nil {
-				return result
-			}
-		}
-	case []interface{}:
-		for _, item := range v {
-			if result := findFieldRecursively(item, fieldName); result != nil {
-				return result
-			}
-		}
-	}
-	return nil
-}
-
-func replaceSessionData(value string, sessionData map[string]interface{}) string {
-	for k, v := range sessionData {
-		placeholder := "{{" + k + "}}"
-		if strings.Contains(value, placeholder) {
-			value = strings.ReplaceAll(value, placeholder, v.(string))
+	//check if responseBody 包含code 且非 0 输出
+	if code := gjson.GetBytes(responseBody, "code"); code.Type == gjson.Number && code.Int() != 0 {
+		if walletAddr, ok := sessionData["walletAddr"]; ok {
+			asyncLog("响应包含错误码: %v, 地址: %v", code.Int(), walletAddr)
 		}
 	}
-	return value
+	asyncLog("地址%s,响应: %v", sessionData["walletAddr"], string(responseBody))
+	return result
 }
 
 var (
 	logChan chan string
-	logWg   sync.WaitGroup
+	// logFlush 接收 FlushLogs 的请求，logWriter 输出缓冲的日志后关闭请求中的通道
+	logFlush chan chan struct{}
+	logWg    sync.WaitGroup
 )
 
 func init() {
 	logChan = make(chan string, 1000) // 缓冲区大小可以根据需要调整
+	logFlush = make(chan chan struct{})
 	logWg.Add(1)
 	go logWriter()
 }
@@ -242,11 +374,26 @@ func init() {
 func logWriter() {
 	defer logWg.Done()
 	logger := log.New(os.Stderr, "", log.LstdFlags)
-	for msg := range logChan {
-		logger.Println(msg)
+	for {
+		select {
+		case msg := <-logChan:
+			logger.Println(msg)
+		case done := <-logFlush:
+			for len(logChan) > 0 {
+				logger.Println(<-logChan)
+			}
+			close(done)
+		}
 	}
 }
 
+// FlushLogs 等待已缓冲的异步日志全部输出，在进程退出前调用
+func FlushLogs() {
+	done := make(chan struct{})
+	logFlush <- done
+	<-done
+}
+
 func asyncLog(format string, v ...interface{}) {
 	select {
 	case logChan <- fmt.Sprintf(format, v...):
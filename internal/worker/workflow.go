@@ -0,0 +1,290 @@
+package worker
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/tyxben/goloadtest/internal/template"
+	"github.com/tyxben/goloadtest/pkg/config"
+)
+
+// step 是编译后的工作流步骤
+type step struct {
+	cfg      config.Step
+	children []*step
+	cond     *template.Expr
+	foreach  *template.Expr
+}
+
+// ValidateWorkflow 检查工作流中引用的 API、条件表达式和控制流参数，在测试开始前发现配置错误
+func ValidateWorkflow(steps []config.Step, apis map[string]config.APIConfig) error {
+	_, err := compileWorkflow(steps, apis)
+	return err
+}
+
+func compileWorkflow(steps []config.Step, apis map[string]config.APIConfig) ([]*step, error) {
+	compiled := make([]*step, 0, len(steps))
+	for i, cfg := range steps {
+		s, err := compileStep(cfg, apis)
+		if err != nil {
+			name := cfg.API
+			if name == "" {
+				name = fmt.Sprintf("第 %d 步", i+1)
+			}
+			return nil, fmt.Errorf("工作流 %s: %w", name, err)
+		}
+		compiled = append(compiled, s)
+	}
+	return compiled, nil
+}
+
+func compileStep(cfg config.Step, apis map[string]config.APIConfig) (*step, error) {
+	s := &step{cfg: cfg}
+
+	switch {
+	case cfg.API != "" && len(cfg.Steps) > 0:
+		return nil, fmt.Errorf("api 和 steps 不能同时设置")
+	case cfg.API != "":
+		if _, ok := apis[cfg.API]; !ok {
+			return nil, fmt.Errorf("API %s 未定义", cfg.API)
+		}
+	case len(cfg.Steps) > 0:
+		children, err := compileWorkflow(cfg.Steps, apis)
+		if err != nil {
+			return nil, err
+		}
+		s.children = children
+	default:
+		return nil, fmt.Errorf("必须设置 api 或 steps")
+	}
+
+	var err error
+	if cfg.If != "" {
+		if s.cond, err = template.CompileExpr(cfg.If); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Foreach != "" {
+		if cfg.Repeat > 0 {
+			return nil, fmt.Errorf("repeat 和 foreach 不能同时设置")
+		}
+		if s.foreach, err = template.CompileExpr(cfg.Foreach); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Repeat < 0 {
+		return nil, fmt.Errorf("repeat 不能为负数")
+	}
+
+	switch cfg.OnError {
+	case "", "abort", "continue", "retry":
+	default:
+		return nil, fmt.Errorf("不支持的 onError %q", cfg.OnError)
+	}
+	if cfg.Retries < 0 {
+		return nil, fmt.Errorf("retries 不能为负数")
+	}
+
+	if t := cfg.Think; t != nil {
+		switch t.Type {
+		case "", "fixed":
+		case "uniform":
+			if t.Max < t.Min {
+				return nil, fmt.Errorf("思考时间的 max 小于 min")
+			}
+		case "gaussian":
+			if t.StdDev < 0 {
+				return nil, fmt.Errorf("思考时间的 stddev 不能为负数")
+			}
+		default:
+			return nil, fmt.Errorf("不支持的思考时间类型 %q", t.Type)
+		}
+	}
+	return s, nil
+}
+
+// runSteps 依次执行 steps，返回导致本次迭代结束的错误
+func (w *Worker) runSteps(steps []*step, sessionData map[string]interface{}) error {
+	for _, s := range steps {
+		if err := w.runStep(s, sessionData); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runStep 按条件和循环设置执行一个步骤
+func (w *Worker) runStep(s *step, sessionData map[string]interface{}) error {
+	if s.cond != nil {
+		v, err := s.cond.Eval(sessionData)
+		if err != nil && !template.IsMissing(err) {
+			return fmt.Errorf("条件 %s: %w", s.cond, err)
+		}
+		// 引用不存在的变量时条件为假
+		if err != nil || !template.Truthy(v) {
+			return nil
+		}
+	}
+
+	switch {
+	case s.foreach != nil:
+		v, err := s.foreach.Eval(sessionData)
+		if template.IsMissing(err) {
+			asyncLog("警告: foreach %s: %v", s.foreach, err)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("foreach %s: %w", s.foreach, err)
+		}
+		items, ok := v.([]interface{})
+		if !ok {
+			return fmt.Errorf("foreach %s 的结果不是数组", s.foreach)
+		}
+		as := s.cfg.As
+		if as == "" {
+			as = "item"
+		}
+		defer saveVars(sessionData, as, "index")()
+		for i, item := range items {
+			sessionData[as] = item
+			sessionData["index"] = int64(i)
+			if err := w.runOnce(s, sessionData); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case s.cfg.Repeat > 0:
+		defer saveVars(sessionData, "index")()
+		for i := 0; i < s.cfg.Repeat; i++ {
+			sessionData["index"] = int64(i)
+			if err := w.runOnce(s, sessionData); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	default:
+		return w.runOnce(s, sessionData)
+	}
+}
+
+// saveVars 保存会话中 names 的当前值，返回的函数把它们恢复原状，原来不存在的变量会被删除。
+// 循环变量写在共用的会话中，内层循环结束后要恢复外层循环的 index 和元素变量
+func saveVars(sessionData map[string]interface{}, names ...string) func() {
+	saved := make(map[string]interface{}, len(names))
+	for _, name := range names {
+		if value, ok := sessionData[name]; ok {
+			saved[name] = value
+		}
+	}
+	return func() {
+		for _, name := range names {
+			if value, ok := saved[name]; ok {
+				sessionData[name] = value
+			} else {
+				delete(sessionData, name)
+			}
+		}
+	}
+}
+
+// runOnce 执行一次步骤，按 onError 处理失败，成功或忽略错误后等待思考时间
+func (w *Worker) runOnce(s *step, sessionData map[string]interface{}) error {
+	err := w.execute(s, sessionData)
+	if err != nil && s.cfg.OnError == "retry" {
+		retries := s.cfg.Retries
+		if retries == 0 {
+			retries = 1
+		}
+		for i := 0; i < retries && err != nil; i++ {
+			if err := w.sleep(s.cfg.RetryDelay.Std()); err != nil {
+				return err
+			}
+			err = w.execute(s, sessionData)
+		}
+	}
+
+	if err != nil {
+		if s.cfg.OnError != "continue" {
+			return err
+		}
+		asyncLog("警告: 忽略步骤错误: %v", err)
+	}
+
+	if s.cfg.Think != nil {
+		return w.sleep(thinkTime(s.cfg.Think))
+	}
+	return nil
+}
+
+// sleep 等待 d，ctx 被取消时提前返回 ctx 的错误
+func (w *Worker) sleep(d time.Duration) error {
+	if d <= 0 {
+		return w.ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-w.ctx.Done():
+		return w.ctx.Err()
+	}
+}
+
+// execute 执行一个 API 请求或一组子步骤
+func (w *Worker) execute(s *step, sessionData map[string]interface{}) error {
+	if s.cfg.API == "" {
+		return w.runSteps(s.children, sessionData)
+	}
+
+	apiConfig := w.cfg.APIs[s.cfg.API]
+	if tmpl, err := loadRequestTemplate(s.cfg.API, w.cfg.BaseURL, apiConfig); err == nil {
+		// 数据集用完时不发送请求，只让本次迭代失败
+		if err := w.drawRequest(tmpl, sessionData); err != nil {
+			return err
+		}
+	}
+	result := w.callAPI(s.cfg.API, apiConfig, sessionData)
+	if err := w.ctx.Err(); err != nil {
+		// 请求被强制中止，不计入统计
+		return err
+	}
+	result.APIName = s.cfg.API
+	result.Scenario = w.cfg.Scenario
+	// 没有收到响应时删除 lastStatus，条件中不会看到上一个请求的状态码
+	if result.StatusCode != 0 {
+		sessionData["lastStatus"] = int64(result.StatusCode)
+	} else {
+		delete(sessionData, "lastStatus")
+	}
+	if result.Error == nil {
+		if err := extractVariables(result, apiConfig.Response, sessionData); err != nil {
+			asyncLog("地址%s,%v", sessionData["walletAddr"], err)
+			result.Error = err
+		}
+	}
+	w.results <- result
+	return result.Error
+}
+
+// thinkTime 按分布生成一次思考时间
+func thinkTime(t *config.ThinkTime) time.Duration {
+	switch t.Type {
+	case "uniform":
+		if t.Max <= t.Min {
+			return t.Min.Std()
+		}
+		return t.Min.Std() + time.Duration(rand.Int63n(int64(t.Max-t.Min)+1))
+	case "gaussian":
+		d := time.Duration(float64(t.Mean) + rand.NormFloat64()*float64(t.StdDev))
+		if d < 0 {
+			return 0
+		}
+		return d
+	default:
+		return t.Duration.Std()
+	}
+}
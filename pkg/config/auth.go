@@ -0,0 +1,171 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// 认证方式
+const (
+	AuthBearer = "bearer"
+	AuthBasic  = "basic"
+	AuthOAuth2 = "oauth2"
+	AuthHMAC   = "hmac"
+	AuthWallet = "wallet"
+)
+
+// AuthNone 写在 API 的 auth 中表示该 API 不使用默认认证
+const AuthNone = "none"
+
+// AuthConfig 是 config.json 中 auth 声明的一个认证提供者。API 通过 auth 字段引用提供者名称，
+// 未设置时使用 defaultAuth。字符串字段除 Type、Share 外都是模板，可以引用会话变量和数据集
+type AuthConfig struct {
+	// Type 是认证方式：bearer、basic、oauth2、hmac 或 wallet
+	Type string `json:"type"`
+	// Header 是放置令牌的请求头，默认使用 tokenHeader，都未设置时为 Authorization
+	Header string `json:"header"`
+	// Scheme 是令牌前缀，默认 Bearer；设为空字符串时请求头中只有令牌本身
+	Scheme *string `json:"scheme"`
+
+	// Token 是 bearer 的静态令牌
+	Token string `json:"token"`
+
+	// Username 和 Password 用于 basic 和 oauth2 的 password 授权
+	Username string `json:"username"`
+	Password string `json:"password"`
+
+	// TokenURL 是 oauth2 获取令牌的地址
+	TokenURL string `json:"tokenURL"`
+	// GrantType 是 oauth2 的授权方式：client_credentials（默认）或 password
+	GrantType    string `json:"grantType"`
+	ClientID     string `json:"clientId"`
+	ClientSecret string `json:"clientSecret"`
+	Scope        string `json:"scope"`
+	// ClientAuth 是 oauth2 客户端凭据的发送方式：basic（默认，HTTP Basic 认证）或 body（放在表单中）
+	ClientAuth string `json:"clientAuth"`
+	// Params 是 oauth2 令牌请求的附加表单参数，如 audience
+	Params map[string]string `json:"params"`
+
+	// Share 是令牌的共享方式：shared（所有虚拟用户共用一个令牌）或 per-vu（每个虚拟用户各自登录）。
+	// oauth2 默认 shared，wallet 默认 per-vu
+	Share string `json:"share"`
+	// RefreshBefore 是令牌过期前提前刷新的时间，默认 30s，最多为令牌有效期的一半
+	RefreshBefore Duration `json:"refreshBefore"`
+	// TTL 是响应中没有过期时间时令牌的有效期，默认 oauth2 为 1 小时，wallet 为不过期
+	TTL Duration `json:"ttl"`
+
+	// AccessKey、SecretKey、SessionToken、Region 和 Service 用于 hmac（AWS SigV4 签名）
+	AccessKey    string `json:"accessKey"`
+	SecretKey    string `json:"secretKey"`
+	SessionToken string `json:"sessionToken"`
+	Region       string `json:"region"`
+	Service      string `json:"service"`
+
+	// LoginURL 是 wallet 的登录地址，相对地址会加上 baseURL
+	LoginURL string `json:"loginURL"`
+	// PrivateKey 是 wallet 的私钥模板
+	PrivateKey string `json:"privateKey"`
+	// Message 是 wallet 待签名消息的模板，为空时按 tool/wallet_tool.go 的格式生成
+	Message string `json:"message"`
+	// Body 是 wallet 登录请求体的 JSON 模板，可以引用 walletAddr、text 和 signature，
+	// 默认为 {"type": "wallet", "wallet_addr": ..., "text": ..., "signature": ...}
+	Body json.RawMessage `json:"body"`
+	// TokenPath 是登录响应中令牌的 gjson 路径，默认 token
+	TokenPath string `json:"tokenPath"`
+}
+
+// 令牌的共享方式
+const (
+	AuthShareShared = "shared"
+	AuthSharePerVU  = "per-vu"
+)
+
+// Validate 检查认证配置的必填字段
+func (a AuthConfig) Validate() error {
+	switch a.Type {
+	case AuthBearer:
+		if a.Token == "" {
+			return fmt.Errorf("bearer 缺少 token")
+		}
+	case AuthBasic:
+		if a.Username == "" {
+			return fmt.Errorf("basic 缺少 username")
+		}
+	case AuthOAuth2:
+		if a.TokenURL == "" {
+			return fmt.Errorf("oauth2 缺少 tokenURL")
+		}
+		switch a.GrantType {
+		case "", "client_credentials":
+			if a.ClientID == "" {
+				return fmt.Errorf("oauth2 client_credentials 缺少 clientId")
+			}
+		case "password":
+			if a.Username == "" {
+				return fmt.Errorf("oauth2 password 缺少 username")
+			}
+		default:
+			return fmt.Errorf("不支持的 oauth2 grantType %q", a.GrantType)
+		}
+		switch a.ClientAuth {
+		case "", "basic", "body":
+		default:
+			return fmt.Errorf("不支持的 oauth2 clientAuth %q", a.ClientAuth)
+		}
+	case AuthHMAC:
+		if a.AccessKey == "" || a.SecretKey == "" || a.Region == "" || a.Service == "" {
+			return fmt.Errorf("hmac 需要 accessKey、secretKey、region 和 service")
+		}
+	case AuthWallet:
+		if a.LoginURL == "" || a.PrivateKey == "" {
+			return fmt.Errorf("wallet 需要 loginURL 和 privateKey")
+		}
+	default:
+		return fmt.Errorf("不支持的认证方式 %q", a.Type)
+	}
+
+	switch a.Share {
+	case "", AuthShareShared, AuthSharePerVU:
+	default:
+		return fmt.Errorf("不支持的 share %q", a.Share)
+	}
+	return nil
+}
+
+// validateAuth 检查认证提供者和 API 对提供者的引用
+func (c *Config) validateAuth() error {
+	for name, a := range c.Auth {
+		if name == AuthNone {
+			return fmt.Errorf("认证提供者不能命名为 %s", AuthNone)
+		}
+		if err := a.Validate(); err != nil {
+			return fmt.Errorf("认证提供者 %s: %w", name, err)
+		}
+	}
+	if c.DefaultAuth != "" {
+		if _, ok := c.Auth[c.DefaultAuth]; !ok {
+			return fmt.Errorf("defaultAuth 引用了不存在的认证提供者 %s", c.DefaultAuth)
+		}
+	}
+	for name, api := range c.APIs {
+		if api.Auth == "" || api.Auth == AuthNone {
+			continue
+		}
+		if _, ok := c.Auth[api.Auth]; !ok {
+			return fmt.Errorf("API %s 引用了不存在的认证提供者 %s", name, api.Auth)
+		}
+	}
+	return nil
+}
+
+// AuthFor 返回 API 使用的认证提供者名称，不需要认证时返回空字符串
+func (c *Config) AuthFor(api APIConfig) string {
+	switch api.Auth {
+	case AuthNone:
+		return ""
+	case "":
+		return c.DefaultAuth
+	default:
+		return api.Auth
+	}
+}
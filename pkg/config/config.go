@@ -1,39 +1,370 @@
 package config
 
 import (
-	"encoding/csv"
+	"bytes"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tyxben/goloadtest/internal/datasource"
 )
 
 type APIConfig struct {
-	URL         string            `json:"url"`
-	Method      string            `json:"method"`
-	Headers     map[string]string `json:"headers"`
-	Body        map[string]string `json:"body"`
+	URL     string            `json:"url"`
+	Method  string            `json:"method"`
+	Headers map[string]string `json:"headers"`
+	// Body 是请求体的 JSON 模板，可以是任意嵌套的 JSON，字符串中的 {{ }} 表达式在发送前渲染
+	Body json.RawMessage `json:"body"`
+	// BodyFile 是请求体 JSON 模板文件的路径，相对于 API 配置文件所在目录，与 Body 互斥
+	BodyFile    string            `json:"bodyFile"`
 	QueryParams map[string]string `json:"queryParams"`
-	Response    map[string]string `json:"response"`
-	Params      []string          `json:"params"`
+	// Response 定义从响应中提取的变量，键为变量名
+	Response map[string]Extractor `json:"response"`
+	Params   []string             `json:"params"`
+	Checks   *ChecksConfig        `json:"checks"`
+	// WalletSign 非空时在发送请求前用钱包私钥生成并签名登录消息
+	WalletSign *WalletSign `json:"walletSign"`
+	// Signing 非空时在请求渲染完成后对请求签名，签名和 nonce 放在请求头中
+	Signing *Signing `json:"signing"`
+	// Auth 是该 API 使用的认证提供者名称，为空时使用 defaultAuth，为 none 时不认证
+	Auth string `json:"auth"`
+	// Timeout 是该 API 请求的超时时间，未设置时使用 transport.timeout
+	Timeout Duration `json:"timeout"`
+}
+
+// Signing 是请求签名的配置。默认按 auth.SignRequest 对 method+url+body+nonce 签名
+type Signing struct {
+	// PrivateKey 是私钥模板，如 {{keys.PrivateKey}}
+	PrivateKey string `json:"privateKey"`
+	// Canonical 是待签名字符串的模板，为空时使用 method+url+body+nonce。
+	// 除会话变量外还可以引用 method、url（含查询参数的完整地址）、path（路径和查询参数）、body 和 nonce
+	Canonical string `json:"canonical"`
+	// SignatureHeader 和 NonceHeader 是签名和 nonce 所在的请求头，默认为 X-Signature 和 X-Nonce
+	SignatureHeader string `json:"signatureHeader"`
+	NonceHeader     string `json:"nonceHeader"`
+}
+
+// WalletSign 是钱包登录的请求前钩子：用 PrivateKey 按 EIP-191 personal_sign 对 Message 签名，
+// 把消息、签名和钱包地址分别写入会话变量 text、signature 和 walletAddr，供请求模板引用
+type WalletSign struct {
+	// PrivateKey 是私钥模板，如 {{wallets.privateKey}}
+	PrivateKey string `json:"privateKey"`
+	// Message 是待签名消息的模板，为空时按 tool/wallet_tool.go 的格式生成，
+	// 如 {{loginMessage nonce}} 可以使用之前步骤从 nonce 接口提取的 nonce。
+	// 渲染消息时 walletAddr 已经是私钥对应的地址，可用于 SIWE 消息
+	Message string `json:"message"`
+}
+
+// Extractor 定义如何从响应中提取一个变量。在 JSON 中可以直接写 gjson 路径字符串，
+// 如 "data.items.0.token"，也可以写成对象指定来源、正则和类型。
+// 只写字段名且根上不存在时按字段名递归查找，与旧版配置兼容
+type Extractor struct {
+	// From 是提取来源：body（默认）、header、cookie 或 status
+	From string `json:"from"`
+	// Path 对 body 是 gjson 路径，对 header 和 cookie 是名称；body 的路径为空时使用整个响应体
+	Path string `json:"path"`
+	// Regex 非空时对来源文本做正则匹配，取 Group 指定的分组（默认有分组时取第 1 组，否则取整个匹配）
+	Regex string `json:"regex"`
+	Group *int   `json:"group"`
+	// Type 是存入会话的类型：string、int、float、bool 或 json，
+	// 默认 body 路径保留 JSON 原始类型，其余为 string
+	Type string `json:"type"`
+	// OnMissing 是提取不到值时的行为：fail（默认，请求记为失败并结束本次迭代）、
+	// warn（记录警告并继续）或 default（使用 Default 的值）
+	OnMissing string          `json:"onMissing"`
+	Default   json.RawMessage `json:"default"`
+}
+
+func (e *Extractor) UnmarshalJSON(data []byte) error {
+	var path string
+	if err := json.Unmarshal(data, &path); err == nil {
+		*e = Extractor{Path: path}
+		return nil
+	}
+
+	type plain Extractor
+	return json.Unmarshal(data, (*plain)(e))
+}
+
+// ChecksConfig 定义对响应的断言，每一项断言都会单独计入统计
+type ChecksConfig struct {
+	// Status 是允许的状态码集合
+	Status []int `json:"status"`
+	// JSON 是对响应体 JSON 路径（gjson 语法）的断言
+	JSON []JSONCheck `json:"json"`
+	// Headers 是响应中必须存在的响应头
+	Headers []string `json:"headers"`
+	// BodyContains 是响应体中必须包含的字符串
+	BodyContains []string `json:"bodyContains"`
+	// MaxLatency 是允许的最大响应时间
+	MaxLatency Duration `json:"maxLatency"`
+	// RecordOnly 为 true 时断言失败只计入统计，不把请求记为失败
+	RecordOnly bool `json:"recordOnly"`
+}
+
+// JSONCheck 是对一个 JSON 路径的断言，Equals、Exists、Regex 可以组合使用
+type JSONCheck struct {
+	Path   string          `json:"path"`
+	Equals json.RawMessage `json:"equals"`
+	Exists *bool           `json:"exists"`
+	Regex  string          `json:"regex"`
+}
+
+// Stage 描述一个负载阶段：在 Duration 内把目标值线性调整到 Target。
+// 封闭模型下目标值是工作协程数，开放模型下是到达速率
+type Stage struct {
+	Duration Duration `json:"duration"`
+	Target   float64  `json:"target"`
 }
 
 type Config struct {
-	TotalRequests int                  `json:"totalRequests"`
-	Concurrency   int                  `json:"concurrency"`
-	Duration      int                  `json:"duration"`
-	Workflow      []string             `json:"workflow"`
-	TokenHeader   string               `json:"tokenHeader"`
-	BaseURL       string               `json:"baseURL"`
-	APIs          map[string]APIConfig `json:"apis"`
-	TestData      []map[string]string
+	TotalRequests int `json:"totalRequests"`
+	Concurrency   int `json:"concurrency"`
+	Duration      int `json:"duration"`
+	// Rate 大于 0 时启用开放模型：按固定到达速率（每秒迭代次数）调度工作流，
+	// 与响应时间无关
+	Rate float64 `json:"rate"`
+	// MaxConcurrency 是开放模型下允许同时运行的最大协程数，达到上限的迭代计为丢弃
+	MaxConcurrency int `json:"maxConcurrency"`
+	// Stages 非空时按阶段调整负载，Duration 不再生效，不能与 TotalRequests 同时设置
+	Stages []Stage `json:"stages"`
+	// HistogramPrecision 是延迟直方图保留的有效数字位数（1-5），默认 3
+	HistogramPrecision int `json:"histogramPrecision"`
+	// Percentiles 是报告中输出的百分位，默认 50/75/90/95/99/99.9/99.99
+	Percentiles []float64 `json:"percentiles"`
+	// GracefulStop 是测试被中断（收到 SIGINT/SIGTERM 或 abortOnFail 阈值不满足）后等待进行中的迭代结束的时间，
+	// 默认 30s，超时后中止进行中的请求
+	GracefulStop Duration `json:"gracefulStop"`
+	// ProgressInterval 是运行期间输出进度的间隔，默认 5s，设为负数关闭进度输出
+	ProgressInterval Duration `json:"progressInterval"`
+	// Workflow 是每次迭代执行的步骤，可以直接写 API 名称，也可以写成带控制流的对象
+	Workflow []Step `json:"workflow"`
+	// Setup 是测试开始前执行一次的步骤（如创建测试账号、获取管理员令牌），
+	// 其中产生的会话变量在所有虚拟用户中只读可用。失败时测试不会开始
+	Setup []Step `json:"setup"`
+	// Teardown 是测试结束后执行一次的步骤，可以引用 setup 产生的变量。
+	// 无论测试是否正常结束、setup 是否成功都会执行
+	Teardown []Step `json:"teardown"`
+	// VUSetup 是每个虚拟用户在第一次迭代前执行一次的步骤（如登录），
+	// 其中新产生的会话变量在该虚拟用户之后的每次迭代中都可以使用
+	VUSetup []Step `json:"vuSetup"`
+	// Cookies 是 Cookie 的保存方式：none（默认）、per-vu 或 per-iteration
+	Cookies string `json:"cookies"`
+	// Persist 是每次迭代结束时保留到该虚拟用户下一次迭代的会话变量
+	Persist []string `json:"persist"`
+	// Transport 是连接池、协议、TLS 和代理等 HTTP 连接配置
+	Transport TransportConfig `json:"transport"`
+	// TokenHeader 是认证提供者放置令牌的默认请求头
+	TokenHeader string               `json:"tokenHeader"`
+	BaseURL     string               `json:"baseURL"`
+	APIs        map[string]APIConfig `json:"apis"`
+	// Auth 是命名的认证提供者，见 AuthConfig
+	Auth map[string]AuthConfig `json:"auth"`
+	// DefaultAuth 是未设置 auth 的 API 使用的认证提供者
+	DefaultAuth string `json:"defaultAuth"`
+	// Thresholds 的键是指标名，可以带标签，如 http_req_duration{api:login}；
+	// 值是该指标需要满足的阈值表达式，如 p(95)<300ms
+	Thresholds map[string][]ThresholdRule `json:"thresholds"`
+	// Outputs 是报告输出目标，格式为 "类型:文件路径"，如 json:report.json、csv:summary.csv、
+	// junit:results.xml。命令行的 -out 参数会追加到这里
+	Outputs []string `json:"outputs"`
+	// Scenarios 非空时按场景并行执行，见 Scenario
+	Scenarios []Scenario `json:"scenarios"`
+	// TestData 是测试数据来源，命令行的 -testdata 参数会覆盖其中的路径
+	TestData DataSourceConfig `json:"testData"`
+	// TestDataPolicy 是测试数据的分发方式
+	TestDataPolicy DataPolicy `json:"testDataPolicy"`
+	// Datasets 是命名数据集，所有场景共用
+	Datasets map[string]Dataset `json:"datasets"`
+	// Scenario 是由 ScenarioConfigs 拆分出的配置对应的场景名
+	Scenario string `json:"-"`
+	// Globals 是 setup 产生的会话变量，由 runner 在 setup 结束后设置，每次迭代开始时复制到会话中
+	Globals map[string]interface{} `json:"-"`
+}
+
+// DataSourceConfig 描述测试数据的来源，见 datasource.Config
+type DataSourceConfig = datasource.Config
+
+// DefaultRandomWindow 是 RandomWindow 的默认值
+const DefaultRandomWindow = 10000
+
+// LoadTestData 读取 CSV 文件的全部数据行，第一行为表头。
+//
+// Deprecated: 测试数据改为通过 datasource.Open 流式读取，支持更多格式，
+// 这里保留原有签名以兼容旧代码
+func LoadTestData(filename string) ([]map[string]string, error) {
+	src, err := datasource.Open(DataSourceConfig{Path: filename, Type: "csv"})
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	var testData []map[string]string
+	for {
+		row, err := src.Next()
+		if errors.Is(err, io.EOF) {
+			return testData, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		data := make(map[string]string, len(row))
+		for k, v := range row {
+			data[k] = fmt.Sprint(v)
+		}
+		testData = append(testData, data)
+	}
+}
+
+// 测试数据的分发方式
+const (
+	// DataModeSequential 按顺序分发，每行只使用一次（默认）
+	DataModeSequential = "sequential"
+	// DataModeCircular 按顺序分发，用完后从头开始
+	DataModeCircular = "circular"
+	// DataModeRandom 每次随机取一行，可以重复。数据行数超过 RandomWindow 时是窗口抽样而不是全量均匀抽样：
+	// 只在内存中保留的 RandomWindow 行里抽取，取出的位置由数据来源的下一行替换
+	DataModeRandom = "random"
+	// DataModeUniquePerVU 每个虚拟用户第一次迭代时取一行，之后一直使用这一行
+	DataModeUniquePerVU = "unique-per-vu"
+)
+
+// DataPolicy 描述测试数据的分发方式
+type DataPolicy struct {
+	// Mode 是分发方式：sequential（默认）、circular、random 或 unique-per-vu
+	Mode string `json:"mode"`
+	// OnExhausted 是按顺序分发的数据用完时的行为：stop（默认，停止派发新的迭代）或 wrap（从头开始）
+	OnExhausted string `json:"onExhausted"`
+}
+
+// Validate 检查分发方式是否合法
+func (p DataPolicy) Validate() error {
+	switch p.Mode {
+	case "", DataModeSequential, "sequential-once", DataModeCircular, DataModeRandom, DataModeUniquePerVU:
+	default:
+		return fmt.Errorf("不支持的测试数据分发方式 %q", p.Mode)
+	}
+	switch p.OnExhausted {
+	case "", "stop", "wrap":
+	default:
+		return fmt.Errorf("不支持的 onExhausted %q", p.OnExhausted)
+	}
+	return nil
+}
+
+// Wraps 返回数据用完后是否从头开始
+func (p DataPolicy) Wraps() bool {
+	return p.Mode == DataModeCircular || p.OnExhausted == "wrap"
+}
+
+// Step 是工作流中的一步。在 JSON 中可以直接写 API 名称，也可以写成对象：
+// API 和 Steps 必须且只能设置一个，Steps 把一组步骤作为整体参与条件、循环和重试
+type Step struct {
+	API   string `json:"api"`
+	Steps []Step `json:"steps"`
+	// If 是执行条件，为表达式（如 eq lastStatus 200、exists orderId），结果为假时跳过该步
+	If string `json:"if"`
+	// Repeat 大于 0 时重复执行该步，循环变量 index 为从 0 开始的次数
+	Repeat int `json:"repeat"`
+	// Foreach 是求值结果为数组的表达式，对每个元素执行一次该步，
+	// 元素存入 As 指定的变量（默认 item），下标存入 index
+	Foreach string `json:"foreach"`
+	As      string `json:"as"`
+	// Think 是该步执行后的思考时间
+	Think *ThinkTime `json:"think"`
+	// OnError 是该步失败时的行为：abort（默认，结束本次迭代）、continue（忽略错误继续）、
+	// retry（重试 Retries 次，间隔 RetryDelay，仍失败时结束本次迭代）
+	OnError    string   `json:"onError"`
+	Retries    int      `json:"retries"`
+	RetryDelay Duration `json:"retryDelay"`
+}
+
+func (s *Step) UnmarshalJSON(data []byte) error {
+	var api string
+	if err := json.Unmarshal(data, &api); err == nil {
+		*s = Step{API: api}
+		return nil
+	}
+
+	type plain Step
+	return json.Unmarshal(data, (*plain)(s))
+}
+
+// ThinkTime 描述思考时间的分布。在 JSON 中可以直接写时长字符串表示固定时间，
+// 也可以写成 {"type": "uniform", "min": "1s", "max": "3s"} 或
+// {"type": "gaussian", "mean": "2s", "stddev": "500ms"}
+type ThinkTime struct {
+	// Type 是分布类型：fixed（默认）、uniform 或 gaussian
+	Type     string   `json:"type"`
+	Duration Duration `json:"duration"`
+	Min      Duration `json:"min"`
+	Max      Duration `json:"max"`
+	Mean     Duration `json:"mean"`
+	StdDev   Duration `json:"stddev"`
+}
+
+func (t *ThinkTime) UnmarshalJSON(data []byte) error {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) == 0 || trimmed[0] != '{' {
+		var d Duration
+		if err := d.UnmarshalJSON(data); err != nil {
+			return err
+		}
+		*t = ThinkTime{Type: "fixed", Duration: d}
+		return nil
+	}
+
+	type plain ThinkTime
+	return json.Unmarshal(data, (*plain)(t))
+}
+
+// ThresholdRule 是一条阈值规则。在 JSON 中可以直接写表达式字符串，
+// 也可以写成 {"threshold": "p(95)<300ms", "abortOnFail": true, "delayAbortEval": "10s"}
+type ThresholdRule struct {
+	Threshold string `json:"threshold"`
+	// AbortOnFail 为 true 时在运行期间持续检查，不满足时立即中止测试
+	AbortOnFail bool `json:"abortOnFail"`
+	// DelayAbortEval 是开始持续检查前的等待时间，避免样本太少时误判
+	DelayAbortEval Duration `json:"delayAbortEval"`
+}
+
+func (r *ThresholdRule) UnmarshalJSON(data []byte) error {
+	var expr string
+	if err := json.Unmarshal(data, &expr); err == nil {
+		*r = ThresholdRule{Threshold: expr}
+		return nil
+	}
+
+	type plain ThresholdRule
+	return json.Unmarshal(data, (*plain)(r))
+}
+
+// stringList 是可以重复指定、也可以用逗号分隔多个值的命令行参数
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
 }
 
 func Parse() (*Config, error) {
 	configFile := flag.String("config", "config.json", "配置文件路径")
 	apiFile := flag.String("api", "api.json", "API配置文件路径")
-	testDataFile := flag.String("testdata", "", "测试数据 CSV 文件路径（可选）")
+	testDataFile := flag.String("testdata", "", "测试数据文件路径（可选），支持 CSV、JSON Lines、JSON 数组和 SQLite")
+	var outputs stringList
+	flag.Var(&outputs, "out", "报告输出目标，如 json:report.json、csv:summary.csv、junit:results.xml（可重复或用逗号分隔）")
 	flag.Parse()
 
 	cfg, err := loadFromFile(*configFile)
@@ -46,13 +377,32 @@ func Parse() (*Config, error) {
 		return nil, fmt.Errorf("加载API配置文件失败: %w", err)
 	}
 	cfg.APIs = apis
+	cfg.Outputs = append(cfg.Outputs, outputs...)
 
+	if err := cfg.TestDataPolicy.Validate(); err != nil {
+		return nil, err
+	}
+	cfg.TestData.Resolve(filepath.Dir(*configFile))
 	if *testDataFile != "" {
-		testData, err := LoadTestData(*testDataFile)
-		if err != nil {
-			return nil, fmt.Errorf("加载测试数据失败: %w", err)
-		}
-		cfg.TestData = testData
+		cfg.TestData.Path = *testDataFile
+	}
+	if err := cfg.loadDatasets(*configFile); err != nil {
+		return nil, fmt.Errorf("加载数据集配置失败: %w", err)
+	}
+	if err := cfg.validateAuth(); err != nil {
+		return nil, fmt.Errorf("加载认证配置失败: %w", err)
+	}
+	if err := cfg.loadTransport(*configFile); err != nil {
+		return nil, fmt.Errorf("加载连接配置失败: %w", err)
+	}
+	if err := cfg.validateSession(); err != nil {
+		return nil, err
+	}
+	if len(cfg.Stages) > 0 && cfg.TotalRequests > 0 {
+		return nil, fmt.Errorf("stages 和 totalRequests 不能同时设置")
+	}
+	if err := cfg.loadScenarios(*configFile); err != nil {
+		return nil, fmt.Errorf("加载场景配置失败: %w", err)
 	}
 
 	return cfg, nil
@@ -87,31 +437,24 @@ func loadAPIsFromFile(filename string) (map[string]APIConfig, error) {
 		return nil, err
 	}
 
-	return apis, nil
-}
-
-func LoadTestData(filename string) ([]map[string]string, error) {
-	file, err := os.Open(filename)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
-	if err != nil {
-		return nil, err
-	}
-
-	headers := records[0]
-	var testData []map[string]string
-	for _, record := range records[1:] {
-		data := make(map[string]string)
-		for i, value := range record {
-			data[headers[i]] = value
+	for name, api := range apis {
+		if api.BodyFile == "" {
+			continue
 		}
-		testData = append(testData, data)
+		if len(api.Body) > 0 {
+			return nil, fmt.Errorf("API %s 不能同时设置 body 和 bodyFile", name)
+		}
+		bodyFile := api.BodyFile
+		if !filepath.IsAbs(bodyFile) {
+			bodyFile = filepath.Join(filepath.Dir(filename), bodyFile)
+		}
+		body, err := ioutil.ReadFile(bodyFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取 API %s 的请求体文件失败: %w", name, err)
+		}
+		api.Body = body
+		apis[name] = api
 	}
 
-	return testData, nil
+	return apis, nil
 }
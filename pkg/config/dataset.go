@@ -0,0 +1,80 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// 命名数据集的取数时机
+const (
+	// BindIteration 每次迭代开始时取一行，整个迭代内的请求使用同一行（默认）
+	BindIteration = "iteration"
+	// BindRequest 每个引用该数据集的请求发送前都重新取一行
+	BindRequest = "request"
+)
+
+// Dataset 是 config.json 中 datasets 声明的一个命名数据集，在模板中用 {{数据集名.列名}} 引用。
+// 在 JSON 中可以直接写文件路径，也可以写成对象：数据来源的字段（path、delimiter 等）、
+// 分发方式的字段（mode、onExhausted）和 bind 写在同一层
+type Dataset struct {
+	Source DataSourceConfig
+	Policy DataPolicy
+	// Bind 是取数时机：iteration（默认）或 request
+	Bind string
+}
+
+func (d *Dataset) UnmarshalJSON(data []byte) error {
+	*d = Dataset{}
+	if err := json.Unmarshal(data, &d.Source); err != nil {
+		return err
+	}
+	if len(data) > 0 && data[0] == '"' {
+		return nil
+	}
+	if err := json.Unmarshal(data, &d.Policy); err != nil {
+		return err
+	}
+	var bind struct {
+		Bind string `json:"bind"`
+	}
+	if err := json.Unmarshal(data, &bind); err != nil {
+		return err
+	}
+	d.Bind = bind.Bind
+	return nil
+}
+
+// PerRequest 返回是否每个请求都重新取一行
+func (d Dataset) PerRequest() bool {
+	return d.Bind == BindRequest
+}
+
+// loadDatasets 检查命名数据集，把数据文件路径转换为相对于配置文件所在目录
+func (c *Config) loadDatasets(configFile string) error {
+	for name, ds := range c.Datasets {
+		if name == "" || strings.ContainsAny(name, ". |(){}\"") {
+			return fmt.Errorf("数据集名称 %q 不合法", name)
+		}
+		if ds.Source.Path == "" {
+			return fmt.Errorf("数据集 %s 缺少 path", name)
+		}
+		if err := ds.Policy.Validate(); err != nil {
+			return fmt.Errorf("数据集 %s: %w", name, err)
+		}
+		switch ds.Bind {
+		case "", BindIteration:
+		case BindRequest:
+			if ds.Policy.Mode == DataModeUniquePerVU {
+				return fmt.Errorf("数据集 %s: 按请求取数时不能使用 %s", name, DataModeUniquePerVU)
+			}
+		default:
+			return fmt.Errorf("数据集 %s: 不支持的 bind %q", name, ds.Bind)
+		}
+
+		ds.Source.Resolve(filepath.Dir(configFile))
+		c.Datasets[name] = ds
+	}
+	return nil
+}
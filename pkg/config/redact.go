@@ -0,0 +1,96 @@
+package config
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+)
+
+// RedactedValue 是报告中替换敏感字段的值
+const RedactedValue = "***"
+
+// Redacted 返回用于输出报告的配置副本，其中的令牌、密码、密钥和私钥都替换为 RedactedValue。
+// 报告会作为 CI 产物归档和分享，不能包含这些值。c 本身不会被修改
+func (c *Config) Redacted() *Config {
+	redacted := *c
+
+	if len(c.Auth) > 0 {
+		redacted.Auth = make(map[string]AuthConfig, len(c.Auth))
+		for name, a := range c.Auth {
+			redact(&a.Token)
+			redact(&a.Password)
+			redact(&a.ClientSecret)
+			redact(&a.SecretKey)
+			redact(&a.SessionToken)
+			redact(&a.PrivateKey)
+			// oauth2 的附加参数中常有断言或密钥，wallet 的登录请求体中有签名
+			if len(a.Params) > 0 {
+				params := make(map[string]string, len(a.Params))
+				for key := range a.Params {
+					params[key] = RedactedValue
+				}
+				a.Params = params
+			}
+			if len(a.Body) > 0 {
+				a.Body = json.RawMessage(`"` + RedactedValue + `"`)
+			}
+			redacted.Auth[name] = a
+		}
+	}
+
+	if len(c.APIs) > 0 {
+		redacted.APIs = make(map[string]APIConfig, len(c.APIs))
+		for name, api := range c.APIs {
+			api.Headers = redactHeaders(api.Headers)
+			if api.Signing != nil {
+				signing := *api.Signing
+				redact(&signing.PrivateKey)
+				api.Signing = &signing
+			}
+			if api.WalletSign != nil {
+				walletSign := *api.WalletSign
+				redact(&walletSign.PrivateKey)
+				api.WalletSign = &walletSign
+			}
+			redacted.APIs[name] = api
+		}
+	}
+
+	// 代理地址中可能带有用户名和密码
+	if u, err := url.Parse(c.Transport.Proxy); err == nil && u.User != nil {
+		redacted.Transport.Proxy = u.Redacted()
+	}
+	return &redacted
+}
+
+// redactHeaders 返回请求头的副本，其中 Authorization、Cookie 以及名称中含有 key、token、
+// secret 或 password 的请求头的值替换为 RedactedValue
+func redactHeaders(headers map[string]string) map[string]string {
+	if len(headers) == 0 {
+		return headers
+	}
+	redacted := make(map[string]string, len(headers))
+	for name, value := range headers {
+		if sensitiveHeader(name) {
+			value = RedactedValue
+		}
+		redacted[name] = value
+	}
+	return redacted
+}
+
+func sensitiveHeader(name string) bool {
+	name = strings.ToLower(name)
+	for _, s := range []string{"authorization", "cookie", "key", "token", "secret", "password"} {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func redact(field *string) {
+	if *field != "" {
+		*field = RedactedValue
+	}
+}
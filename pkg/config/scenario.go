@@ -0,0 +1,144 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+)
+
+// Scenario 是一个命名的负载场景。多个场景在同一次运行中并行执行，
+// 未单独设置的负载参数（并发数、到达速率、请求总数、阶段）按权重从全局配置中分配
+type Scenario struct {
+	Name string `json:"name"`
+	// Weight 是场景的权重，默认为 1
+	Weight float64 `json:"weight"`
+	// Workflow 为空时使用全局工作流
+	Workflow []Step `json:"workflow"`
+	// VUSetup 为空时使用全局的 vuSetup
+	VUSetup []Step `json:"vuSetup"`
+	// TestData 是场景专用的测试数据来源，为空时与其他场景共用全局的测试数据
+	TestData *DataSourceConfig `json:"testData"`
+	// TestDataPolicy 是场景专用测试数据的分发方式，未设置时使用全局的 testDataPolicy
+	TestDataPolicy *DataPolicy `json:"testDataPolicy"`
+	Concurrency    int         `json:"concurrency"`
+	TotalRequests  int         `json:"totalRequests"`
+	Duration       int         `json:"duration"`
+	Rate           float64     `json:"rate"`
+	MaxConcurrency int         `json:"maxConcurrency"`
+	Stages         []Stage     `json:"stages"`
+}
+
+// loadScenarios 检查场景配置，把场景测试数据的路径转换为相对于配置文件所在目录
+func (c *Config) loadScenarios(configFile string) error {
+	names := make(map[string]bool, len(c.Scenarios))
+	for i := range c.Scenarios {
+		sc := &c.Scenarios[i]
+		if sc.Name == "" {
+			return fmt.Errorf("第 %d 个场景缺少 name", i+1)
+		}
+		if names[sc.Name] {
+			return fmt.Errorf("场景 %s 重复", sc.Name)
+		}
+		names[sc.Name] = true
+		if sc.Weight < 0 {
+			return fmt.Errorf("场景 %s 的权重不能为负数", sc.Name)
+		}
+		// 场景的 stages 会覆盖全局的 totalRequests，但不能与自己的 totalRequests 同时设置；
+		// 沿用全局 stages 时场景的 totalRequests 同样不会生效
+		if sc.TotalRequests > 0 && (len(sc.Stages) > 0 || len(c.Stages) > 0) {
+			return fmt.Errorf("场景 %s 的 stages 和 totalRequests 不能同时设置", sc.Name)
+		}
+		if len(sc.Workflow) == 0 && len(c.Workflow) == 0 {
+			return fmt.Errorf("场景 %s 缺少 workflow", sc.Name)
+		}
+
+		if sc.TestDataPolicy != nil {
+			if err := sc.TestDataPolicy.Validate(); err != nil {
+				return fmt.Errorf("场景 %s: %w", sc.Name, err)
+			}
+		}
+
+		if sc.TestData != nil {
+			sc.TestData.Resolve(filepath.Dir(configFile))
+		}
+	}
+	return nil
+}
+
+// ScenarioConfigs 把配置按场景拆分为独立的配置，每个配置的 Scenario 为场景名。
+// 没有配置场景时返回只包含 c 本身的列表
+func (c *Config) ScenarioConfigs() []*Config {
+	if len(c.Scenarios) == 0 {
+		return []*Config{c}
+	}
+
+	totalWeight := 0.0
+	for _, sc := range c.Scenarios {
+		totalWeight += scenarioWeight(sc)
+	}
+
+	configs := make([]*Config, 0, len(c.Scenarios))
+	for _, sc := range c.Scenarios {
+		share := 0.0
+		if totalWeight > 0 {
+			share = scenarioWeight(sc) / totalWeight
+		}
+
+		cfg := *c
+		cfg.Scenarios = nil
+		cfg.Scenario = sc.Name
+		if len(sc.Workflow) > 0 {
+			cfg.Workflow = sc.Workflow
+		}
+		if len(sc.VUSetup) > 0 {
+			cfg.VUSetup = sc.VUSetup
+		}
+		if sc.TestData != nil {
+			cfg.TestData = *sc.TestData
+		}
+		if sc.TestDataPolicy != nil {
+			cfg.TestDataPolicy = *sc.TestDataPolicy
+		}
+
+		cfg.TotalRequests = pickInt(sc.TotalRequests, int(math.Round(float64(c.TotalRequests)*share)))
+		if len(sc.Stages) > 0 {
+			// 按阶段调整负载的场景不分配请求总数
+			cfg.TotalRequests = 0
+		}
+		cfg.Duration = pickInt(sc.Duration, c.Duration)
+		cfg.Rate = c.Rate * share
+		if sc.Rate > 0 {
+			cfg.Rate = sc.Rate
+		}
+		cfg.MaxConcurrency = pickInt(sc.MaxConcurrency, int(math.Ceil(float64(c.MaxConcurrency)*share)))
+		if len(sc.Stages) > 0 {
+			cfg.Stages = sc.Stages
+		} else if len(c.Stages) > 0 {
+			cfg.Stages = make([]Stage, len(c.Stages))
+			for i, stage := range c.Stages {
+				cfg.Stages[i] = Stage{Duration: stage.Duration, Target: stage.Target * share}
+			}
+		}
+		cfg.Concurrency = pickInt(sc.Concurrency, int(math.Round(float64(c.Concurrency)*share)))
+		// 封闭模型下权重很小的场景至少保留一个虚拟用户
+		if cfg.Concurrency < 1 && share > 0 && cfg.Rate == 0 && len(cfg.Stages) == 0 {
+			cfg.Concurrency = 1
+		}
+		configs = append(configs, &cfg)
+	}
+	return configs
+}
+
+func scenarioWeight(sc Scenario) float64 {
+	if sc.Weight == 0 {
+		return 1
+	}
+	return sc.Weight
+}
+
+func pickInt(override, fallback int) int {
+	if override != 0 {
+		return override
+	}
+	return fallback
+}
@@ -0,0 +1,28 @@
+package config
+
+import "fmt"
+
+// Cookie 的保存方式
+const (
+	// CookiesNone 不保存 Cookie（默认）
+	CookiesNone = "none"
+	// CookiesPerVU 每个虚拟用户一个 Cookie 容器，在迭代之间保留
+	CookiesPerVU = "per-vu"
+	// CookiesPerIteration 每次迭代开始时清空虚拟用户的 Cookie 容器
+	CookiesPerIteration = "per-iteration"
+)
+
+// validateSession 检查 Cookie 保存方式和需要在迭代之间保留的变量
+func (c *Config) validateSession() error {
+	switch c.Cookies {
+	case "", CookiesNone, CookiesPerVU, CookiesPerIteration:
+	default:
+		return fmt.Errorf("不支持的 cookies %q", c.Cookies)
+	}
+	for _, name := range c.Persist {
+		if name == "" {
+			return fmt.Errorf("persist 中的变量名不能为空")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// HTTP 协议
+const (
+	// ProtocolAuto 对 HTTPS 通过 ALPN 协商 HTTP/2，对 HTTP 使用 HTTP/1.1（默认）
+	ProtocolAuto = ""
+	// ProtocolHTTP1 强制使用 HTTP/1.1
+	ProtocolHTTP1 = "http1"
+	// ProtocolH2C 对明文 HTTP 直接使用 HTTP/2（prior knowledge）
+	ProtocolH2C = "h2c"
+)
+
+// DefaultTimeout 是未设置 transport.timeout 时请求的超时时间
+const DefaultTimeout = Duration(10 * time.Second)
+
+// TransportConfig 是所有虚拟用户共用的 HTTP 连接配置
+type TransportConfig struct {
+	// Timeout 是请求的超时时间，包括读取响应体，默认 10s，设为负数表示不超时。API 的 timeout 可以覆盖
+	Timeout Duration `json:"timeout"`
+	// MaxIdleConns 和 MaxIdleConnsPerHost 是连接池中保留的空闲连接数，默认与 Go 的默认值相同（100 和 2）。
+	// 并发数较大时应把 MaxIdleConnsPerHost 设为不小于并发数，否则连接会被频繁关闭和重建
+	MaxIdleConns        int `json:"maxIdleConns"`
+	MaxIdleConnsPerHost int `json:"maxIdleConnsPerHost"`
+	// MaxConnsPerHost 限制每个主机的连接总数，默认不限制
+	MaxConnsPerHost int `json:"maxConnsPerHost"`
+	// IdleConnTimeout 是空闲连接保留的时间，默认 90s
+	IdleConnTimeout Duration `json:"idleConnTimeout"`
+	// DisableKeepAlives 为 true 时每个请求都使用新连接，模拟大量新客户端
+	DisableKeepAlives bool `json:"disableKeepAlives"`
+	// Protocol 是 HTTP 协议：空（默认，自动协商）、http1 或 h2c
+	Protocol string `json:"protocol"`
+
+	// InsecureSkipVerify 为 true 时不校验服务端证书
+	InsecureSkipVerify bool `json:"insecureSkipVerify"`
+	// CACert 是附加的 CA 证书（PEM）文件，与系统证书一起用于校验服务端证书
+	CACert string `json:"caCert"`
+	// ClientCert 和 ClientKey 是 mTLS 的客户端证书和私钥（PEM）文件，必须同时设置
+	ClientCert string `json:"clientCert"`
+	ClientKey  string `json:"clientKey"`
+	// ServerName 是 TLS 握手使用的服务端名称，默认为请求的主机名
+	ServerName string `json:"serverName"`
+
+	// Proxy 是代理地址，如 http://127.0.0.1:8888，默认使用环境变量 HTTP_PROXY、HTTPS_PROXY 和 NO_PROXY
+	Proxy string `json:"proxy"`
+}
+
+// loadTransport 检查连接配置，把证书路径转换为相对于配置文件所在目录
+func (c *Config) loadTransport(configFile string) error {
+	t := &c.Transport
+	switch t.Protocol {
+	case ProtocolAuto, ProtocolHTTP1:
+	case ProtocolH2C:
+		if !strings.HasPrefix(c.BaseURL, "http://") {
+			return fmt.Errorf("h2c 只能用于 http:// 的 baseURL")
+		}
+		// h2c 在一个连接上复用所有请求，连接数和长连接相关的配置没有意义
+		switch {
+		case t.Proxy != "":
+			return fmt.Errorf("h2c 不支持代理")
+		case t.DisableKeepAlives:
+			return fmt.Errorf("h2c 不支持 disableKeepAlives")
+		case t.MaxConnsPerHost > 0 || t.MaxIdleConns > 0 || t.MaxIdleConnsPerHost > 0:
+			return fmt.Errorf("h2c 不支持 maxConnsPerHost、maxIdleConns 和 maxIdleConnsPerHost")
+		}
+	default:
+		return fmt.Errorf("不支持的 protocol %q", t.Protocol)
+	}
+	if (t.ClientCert == "") != (t.ClientKey == "") {
+		return fmt.Errorf("clientCert 和 clientKey 必须同时设置")
+	}
+	if t.Proxy != "" {
+		u, err := url.Parse(t.Proxy)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("proxy 不是合法的地址: %q", t.Proxy)
+		}
+	}
+	for name, api := range c.APIs {
+		if api.Timeout < 0 {
+			return fmt.Errorf("API %s 的 timeout 不能为负数", name)
+		}
+	}
+
+	dir := filepath.Dir(configFile)
+	for _, path := range []*string{&t.CACert, &t.ClientCert, &t.ClientKey} {
+		if *path != "" && !filepath.IsAbs(*path) {
+			*path = filepath.Join(dir, *path)
+		}
+	}
+	return nil
+}
+
+// RequestTimeout 返回请求的超时时间，为 0 表示不超时
+func (t TransportConfig) RequestTimeout() time.Duration {
+	switch {
+	case t.Timeout < 0:
+		return 0
+	case t.Timeout == 0:
+		return DefaultTimeout.Std()
+	default:
+		return t.Timeout.Std()
+	}
+}
@@ -0,0 +1,129 @@
+package siwe
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 期望的消息文本按 EIP-4361 的 ABNF 逐字写出，tool 目录下的钱包工具也按同样的格式生成消息
+func TestMessageString(t *testing.T) {
+	issuedAt := time.Date(2021, 9, 30, 16, 25, 24, 0, time.UTC)
+	tests := []struct {
+		name string
+		msg  Message
+		want string
+	}{
+		{
+			name: "with statement",
+			msg: Message{
+				Domain:    "service.org",
+				Address:   "0xcd2a3d9f938e13cd947ec05abc7fe734df8dd826",
+				Statement: "I accept the ServiceOrg Terms of Service: https://service.org/tos",
+				URI:       "https://service.org/login",
+				ChainID:   1,
+				Nonce:     "32891757",
+				IssuedAt:  issuedAt,
+			},
+			want: "service.org wants you to sign in with your Ethereum account:\n" +
+				"0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826\n" +
+				"\n" +
+				"I accept the ServiceOrg Terms of Service: https://service.org/tos\n" +
+				"\n" +
+				"URI: https://service.org/login\n" +
+				"Version: 1\n" +
+				"Chain ID: 1\n" +
+				"Nonce: 32891757\n" +
+				"Issued At: 2021-09-30T16:25:24Z",
+		},
+		{
+			name: "without statement",
+			msg: Message{
+				Domain:   "service.org",
+				Address:  "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826",
+				URI:      "https://service.org/login",
+				ChainID:  1,
+				Nonce:    "32891757",
+				IssuedAt: issuedAt,
+			},
+			want: "service.org wants you to sign in with your Ethereum account:\n" +
+				"0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826\n" +
+				"\n" +
+				"\n" +
+				"URI: https://service.org/login\n" +
+				"Version: 1\n" +
+				"Chain ID: 1\n" +
+				"Nonce: 32891757\n" +
+				"Issued At: 2021-09-30T16:25:24Z",
+		},
+		{
+			name: "optional fields",
+			msg: Message{
+				Domain:         "service.org",
+				Address:        "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826",
+				Statement:      "Sign in",
+				URI:            "https://service.org/login",
+				Version:        "1",
+				ChainID:        137,
+				Nonce:          "32891757",
+				IssuedAt:       issuedAt.In(time.FixedZone("CST", 8*3600)),
+				ExpirationTime: issuedAt.Add(time.Hour),
+				NotBefore:      issuedAt,
+				RequestID:      "req-1",
+				Resources:      []string{"ipfs://bafybeiemxf5abjwjbikoz4mc3a3dla6ual3jsgpdr4cjr3oz3evfyavhwq/", "https://example.com/my-web2-claim.json"},
+			},
+			want: "service.org wants you to sign in with your Ethereum account:\n" +
+				"0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826\n" +
+				"\n" +
+				"Sign in\n" +
+				"\n" +
+				"URI: https://service.org/login\n" +
+				"Version: 1\n" +
+				"Chain ID: 137\n" +
+				"Nonce: 32891757\n" +
+				"Issued At: 2021-09-30T16:25:24Z\n" +
+				"Expiration Time: 2021-09-30T17:25:24Z\n" +
+				"Not Before: 2021-09-30T16:25:24Z\n" +
+				"Request ID: req-1\n" +
+				"Resources:\n" +
+				"- ipfs://bafybeiemxf5abjwjbikoz4mc3a3dla6ual3jsgpdr4cjr3oz3evfyavhwq/\n" +
+				"- https://example.com/my-web2-claim.json",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.msg.String(); got != tt.want {
+				t.Errorf("消息文本 =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMessageDefaults(t *testing.T) {
+	msg := Message{Domain: "service.org", Address: "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826", URI: "https://service.org", ChainID: 1, Nonce: "32891756"}
+	text := msg.String()
+	if !strings.Contains(text, "\nVersion: 1\n") {
+		t.Errorf("缺少默认版本: %q", text)
+	}
+	if !regexp.MustCompile(`\nIssued At: \d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}Z$`).MatchString(text) {
+		t.Errorf("缺少签发时间: %q", text)
+	}
+}
+
+func TestNonce(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		nonce, err := Nonce()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !regexp.MustCompile(`^[A-Za-z0-9]{17}$`).MatchString(nonce) {
+			t.Errorf("nonce %q 不是 17 位字母数字", nonce)
+		}
+		seen[nonce] = true
+	}
+	if len(seen) != 20 {
+		t.Errorf("20 次生成只得到 %d 个不同的 nonce", len(seen))
+	}
+}
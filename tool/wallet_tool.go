@@ -2,16 +2,23 @@ package main
 
 import (
 	"crypto/ecdsa"
+	"crypto/rand"
 	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
-	"math/rand"
+	"math/big"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/tyxben/goloadtest/pkg/siwe"
 )
 
 func main() {
@@ -23,8 +30,23 @@ func main() {
 	signInput := signCmd.String("input", "", "Input CSV file with addresses and private keys")
 	signOutput := signCmd.String("output", "signed_data.csv", "Output CSV file name")
 
+	siweCmd := flag.NewFlagSet("siwe", flag.ExitOnError)
+	siweInput := siweCmd.String("input", "", "Input CSV file with addresses and private keys")
+	siweOutput := siweCmd.String("output", "siwe_data.csv", "Output CSV file name")
+	siweDomain := siweCmd.String("domain", "", "Domain requesting the sign-in, e.g. app.example.com")
+	siweURI := siweCmd.String("uri", "", "URI of the resource being signed in to, e.g. https://app.example.com/login")
+	siweChainID := siweCmd.Int64("chain-id", 1, "EIP-155 chain ID")
+	siweStatement := siweCmd.String("statement", "", "Optional human-readable statement")
+	siweExpires := siweCmd.Duration("expires", 0, "Optional validity period, e.g. 10m; 0 means no expiration")
+
+	typedCmd := flag.NewFlagSet("sign-typed", flag.ExitOnError)
+	typedData := typedCmd.String("data", "", "JSON file with EIP-712 typed data (eth_signTypedData_v4 format)")
+	typedKey := typedCmd.String("key", "", "Private key to sign with (hex)")
+	typedInput := typedCmd.String("input", "", "Input CSV file with addresses and private keys, signs once per wallet")
+	typedOutput := typedCmd.String("output", "typed_data.csv", "Output CSV file name when -input is set")
+
 	if len(os.Args) < 2 {
-		fmt.Println("Expected 'generate' or 'sign' subcommands")
+		fmt.Println("Expected 'generate', 'sign', 'siwe' or 'sign-typed' subcommands")
 		os.Exit(1)
 	}
 
@@ -38,8 +60,26 @@ func main() {
 			log.Fatal("Input file is required for sign command")
 		}
 		signMessages(*signInput, *signOutput)
+	case "siwe":
+		siweCmd.Parse(os.Args[2:])
+		if *siweInput == "" || *siweDomain == "" || *siweURI == "" {
+			log.Fatal("Input file, domain and uri are required for siwe command")
+		}
+		signSIWEMessages(*siweInput, *siweOutput, siweParams{
+			domain:    *siweDomain,
+			uri:       *siweURI,
+			chainID:   *siweChainID,
+			statement: *siweStatement,
+			expires:   *siweExpires,
+		})
+	case "sign-typed":
+		typedCmd.Parse(os.Args[2:])
+		if *typedData == "" || (*typedKey == "") == (*typedInput == "") {
+			log.Fatal("Data file and exactly one of key or input are required for sign-typed command")
+		}
+		signTypedDataFile(*typedData, *typedKey, *typedInput, *typedOutput)
 	default:
-		fmt.Println("Expected 'generate' or 'sign' subcommands")
+		fmt.Println("Expected 'generate', 'sign', 'siwe' or 'sign-typed' subcommands")
 		os.Exit(1)
 	}
 }
@@ -74,11 +114,10 @@ func generateWallets(count int, outputFile string) {
 }
 
 func signMessages(inputFile, outputFile string) {
-	inFile, err := os.Open(inputFile)
+	wallets, err := readWallets(inputFile)
 	if err != nil {
-		log.Fatalf("Cannot open input file: %v", err)
+		log.Fatal(err)
 	}
-	defer inFile.Close()
 
 	outFile, err := os.Create(outputFile)
 	if err != nil {
@@ -86,55 +125,220 @@ func signMessages(inputFile, outputFile string) {
 	}
 	defer outFile.Close()
 
-	reader := csv.NewReader(inFile)
 	writer := csv.NewWriter(outFile)
 	defer writer.Flush()
 
 	writer.Write([]string{"walletAddr", "type", "text", "signature"})
 
+	for _, wallet := range wallets {
+		address := wallet[0]
+
+		privateKey, err := crypto.HexToECDSA(strings.TrimPrefix(wallet[1], "0x"))
+		if err != nil {
+			log.Fatalf("Failed to parse private key: %v", err)
+		}
+
+		message, err := generateMessage()
+		if err != nil {
+			log.Fatalf("Failed to generate message: %v", err)
+		}
+		signature, err := signMessage(message, privateKey)
+		if err != nil {
+			log.Fatalf("Failed to sign message: %v", err)
+		}
+
+		writer.Write([]string{address, "wallet", message, signature})
+	}
+
+	fmt.Printf("Generated signed messages and saved to %s\n", outputFile)
+}
+
+func generateMessage() (string, error) {
+	uniqueNumber, err := rand.Int(rand.Reader, big.NewInt(1000000000))
+	if err != nil {
+		return "", err
+	}
+	expirationTime := time.Now().UTC().Add(2 * time.Minute).Format(time.RFC3339)
+
+	return fmt.Sprintf("Hello! airdrop.carv.io asks you to sign this message to confirm your ownership of the address. This action will not cost any gas fee. \n\nHere is a unique number: %d\n\nExpiration time: %s\n", uniqueNumber, expirationTime), nil
+}
+
+func signMessage(message string, privateKey *ecdsa.PrivateKey) (string, error) {
+	fullMessage := fmt.Sprintf("\x19Ethereum Signed Message:\n%d%s", len(message), message)
+	hash := crypto.Keccak256Hash([]byte(fullMessage))
+	signature, err := crypto.Sign(hash.Bytes(), privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	signature[64] += 27 // Transform V from 0/1 to 27/28 according to the yellow paper
+
+	return hexutil.Encode(signature), nil
+}
+
+type siweParams struct {
+	domain    string
+	uri       string
+	chainID   int64
+	statement string
+	expires   time.Duration
+}
+
+// readWallets reads address and private key pairs from a CSV file written by the generate command
+func readWallets(inputFile string) ([][2]string, error) {
+	inFile, err := os.Open(inputFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open input file: %w", err)
+	}
+	defer inFile.Close()
+
+	reader := csv.NewReader(inFile)
+
 	// Skip header
 	_, err = reader.Read()
 	if err != nil {
-		log.Fatalf("Failed to read CSV header: %v", err)
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
 	}
 
+	var wallets [][2]string
 	for {
 		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return wallets, nil
+		}
 		if err != nil {
-			break // End of file
+			return nil, fmt.Errorf("failed to read %s: %w", inputFile, err)
 		}
+		if len(record) < 2 {
+			line, _ := reader.FieldPos(0)
+			return nil, fmt.Errorf("%s line %d: expected address and private key", inputFile, line)
+		}
+		wallets = append(wallets, [2]string{record[0], record[1]})
+	}
+}
+
+func signSIWEMessages(inputFile, outputFile string, params siweParams) {
+	wallets, err := readWallets(inputFile)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-		address := record[0]
-		privateKeyHex := record[1]
+	outFile, err := os.Create(outputFile)
+	if err != nil {
+		log.Fatalf("Cannot create output file: %v", err)
+	}
+	defer outFile.Close()
 
-		privateKey, err := crypto.HexToECDSA(privateKeyHex)
+	writer := csv.NewWriter(outFile)
+	defer writer.Flush()
+
+	writer.Write([]string{"walletAddr", "type", "text", "signature"})
+
+	for _, wallet := range wallets {
+		privateKey, err := crypto.HexToECDSA(strings.TrimPrefix(wallet[1], "0x"))
 		if err != nil {
 			log.Fatalf("Failed to parse private key: %v", err)
 		}
 
-		message := generateMessage()
+		address := crypto.PubkeyToAddress(privateKey.PublicKey).Hex()
+		message, err := generateSIWEMessage(address, params)
+		if err != nil {
+			log.Fatalf("Failed to generate SIWE message: %v", err)
+		}
 		signature, err := signMessage(message, privateKey)
 		if err != nil {
 			log.Fatalf("Failed to sign message: %v", err)
 		}
 
-		writer.Write([]string{address, "wallet", message, signature})
+		writer.Write([]string{address, "siwe", message, signature})
 	}
 
-	fmt.Printf("Generated signed messages and saved to %s\n", outputFile)
+	fmt.Printf("Generated SIWE messages and saved to %s\n", outputFile)
 }
 
-func generateMessage() string {
-	uniqueNumber := rand.Intn(1000000000)
-	expirationTime := time.Now().UTC().Add(2 * time.Minute).Format(time.RFC3339)
+// generateSIWEMessage builds an EIP-4361 Sign-In with Ethereum message,
+// using the same formatter as the siweMessage template function of the load tester
+func generateSIWEMessage(address string, params siweParams) (string, error) {
+	nonce, err := siwe.Nonce()
+	if err != nil {
+		return "", err
+	}
+	msg := siwe.Message{
+		Domain:    params.domain,
+		Address:   address,
+		Statement: params.statement,
+		URI:       params.uri,
+		ChainID:   params.chainID,
+		Nonce:     nonce,
+		IssuedAt:  time.Now().UTC(),
+	}
+	if params.expires > 0 {
+		msg.ExpirationTime = msg.IssuedAt.Add(params.expires)
+	}
+	return msg.String(), nil
+}
+
+func signTypedDataFile(dataFile, privateKeyHex, inputFile, outputFile string) {
+	raw, err := os.ReadFile(dataFile)
+	if err != nil {
+		log.Fatalf("Cannot read typed data file: %v", err)
+	}
+	var typedData apitypes.TypedData
+	if err := json.Unmarshal(raw, &typedData); err != nil {
+		log.Fatalf("Failed to parse typed data: %v", err)
+	}
+	hash, _, err := apitypes.TypedDataAndHash(typedData)
+	if err != nil {
+		log.Fatalf("Failed to hash typed data: %v", err)
+	}
+
+	if inputFile == "" {
+		privateKey, err := crypto.HexToECDSA(strings.TrimPrefix(privateKeyHex, "0x"))
+		if err != nil {
+			log.Fatalf("Failed to parse private key: %v", err)
+		}
+		signature, err := signTypedDataHash(hash, privateKey)
+		if err != nil {
+			log.Fatalf("Failed to sign typed data: %v", err)
+		}
+		fmt.Printf("Hash: %s\nSignature: %s\n", hexutil.Encode(hash), signature)
+		return
+	}
+
+	wallets, err := readWallets(inputFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	outFile, err := os.Create(outputFile)
+	if err != nil {
+		log.Fatalf("Cannot create output file: %v", err)
+	}
+	defer outFile.Close()
 
-	return fmt.Sprintf("Hello! airdrop.carv.io asks you to sign this message to confirm your ownership of the address. This action will not cost any gas fee. \n\nHere is a unique number: %d\n\nExpiration time: %s\n", uniqueNumber, expirationTime)
+	writer := csv.NewWriter(outFile)
+	defer writer.Flush()
+
+	writer.Write([]string{"walletAddr", "signature"})
+
+	for _, wallet := range wallets {
+		privateKey, err := crypto.HexToECDSA(strings.TrimPrefix(wallet[1], "0x"))
+		if err != nil {
+			log.Fatalf("Failed to parse private key: %v", err)
+		}
+		signature, err := signTypedDataHash(hash, privateKey)
+		if err != nil {
+			log.Fatalf("Failed to sign typed data: %v", err)
+		}
+		writer.Write([]string{crypto.PubkeyToAddress(privateKey.PublicKey).Hex(), signature})
+	}
+
+	fmt.Printf("Generated typed data signatures and saved to %s\n", outputFile)
 }
 
-func signMessage(message string, privateKey *ecdsa.PrivateKey) (string, error) {
-	fullMessage := fmt.Sprintf("\x19Ethereum Signed Message:\n%d%s", len(message), message)
-	hash := crypto.Keccak256Hash([]byte(fullMessage))
-	signature, err := crypto.Sign(hash.Bytes(), privateKey)
+// signTypedDataHash signs an EIP-712 digest the same way eth_signTypedData_v4 does
+func signTypedDataHash(hash []byte, privateKey *ecdsa.PrivateKey) (string, error) {
+	signature, err := crypto.Sign(hash, privateKey)
 	if err != nil {
 		return "", err
 	}